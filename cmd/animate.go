@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// animationFile is an animation as written in JSON or YAML files
+type animationFile struct {
+	FPS    float64 `yaml:"fps"`
+	Loop   bool    `yaml:"loop"`
+	Jitter struct {
+		Bright int `yaml:"bright"`
+		Hue    int `yaml:"hue"`
+	} `yaml:"jitter"`
+	Keyframes []struct {
+		At     string `yaml:"at"`
+		Color  string `yaml:"color"`
+		CT     int    `yaml:"ct"`
+		Bright int    `yaml:"bright"`
+		Easing string `yaml:"easing"`
+	} `yaml:"keyframes"`
+}
+
+// readAnimation reads an animation from a JSON or YAML file
+func readAnimation(path string) (yeelight.Animation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return yeelight.Animation{}, err
+	}
+
+	// YAML is a superset of JSON, both are read the same way
+	var file animationFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return yeelight.Animation{}, fmt.Errorf("Cannot read animation %s: %w", path, err)
+	}
+
+	anim := yeelight.Animation{
+		FPS:    file.FPS,
+		Loop:   file.Loop,
+		Jitter: yeelight.Jitter{Bright: file.Jitter.Bright, Hue: file.Jitter.Hue},
+	}
+	if anim.FPS == 0 {
+		anim.FPS = 10
+	}
+
+	for i, k := range file.Keyframes {
+		at, err := time.ParseDuration(k.At)
+		if err != nil {
+			return yeelight.Animation{}, fmt.Errorf("Keyframe %d: invalid instant %q", i+1, k.At)
+		}
+
+		var rgb int64
+		if k.Color != "" {
+			rgb, err = strconv.ParseInt(strings.TrimPrefix(k.Color, "#"), 16, 32)
+			if err != nil {
+				return yeelight.Animation{}, fmt.Errorf("Keyframe %d: invalid color %q", i+1, k.Color)
+			}
+		}
+
+		anim.Keyframes = append(anim.Keyframes, yeelight.Keyframe{
+			At:     at,
+			Frame:  yeelight.Frame{Bright: k.Bright, RGB: int(rgb), ColorTemp: k.CT},
+			Easing: yeelight.Easing(k.Easing),
+		})
+	}
+
+	return anim, anim.Validate()
+}
+
+var animateCmd = &cobra.Command{
+	Use:   "animate [name/IP] [file]",
+	Short: "Play an animation defined in a JSON or YAML file",
+	Long: `Play an animation defined in a JSON or YAML file, rendered frame by frame
+through music mode. Unlike color flows, animations support easing curves and random jitter.
+
+Example of animation file:
+  fps: 15
+  loop: true
+  jitter: {bright: 15, hue: 5}
+  keyframes:
+    - {at: 0s, color: ff4500, bright: 70, easing: sine}
+    - {at: 400ms, color: ff8c00, bright: 100, easing: sine}
+    - {at: 800ms, color: ff4500, bright: 70}
+
+Easing curves are linear, ease-in-out, cubic, step and sine.
+A keyframe sets either a color (hexadecimal) or a color temperature (ct).`,
+	Example:           "yeego animate bedroom fire.yaml",
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeArgs(completeTargets, nil),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		matched, err := resolveTargets(args[0])
+		if err != nil {
+			return err
+		}
+
+		anim, err := readAnimation(args[1])
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		err = yeelight.Animate(ctx, anim, matched, "")
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(animateCmd)
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/julienrbrt/yeego/internal/audio"
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+// audioMapping turns audio features into frames
+type audioMapping struct {
+	bright    string
+	hue       string
+	minBright int
+	maxBright int
+	hueStep   float64
+	sat       float64
+
+	currentHue float64
+}
+
+// validate checks the mapping, before the lights are touched
+func (m *audioMapping) validate() error {
+	switch m.bright {
+	case "rms", "bass", "mid", "treble":
+	default:
+		return errors.New("Brightness source invalid. Please check help")
+	}
+
+	switch m.hue {
+	case "beat", "centroid":
+	default:
+		return errors.New("Hue source invalid. Please check help")
+	}
+
+	if m.minBright < 1 || m.maxBright > 100 || m.minBright > m.maxBright {
+		return errors.New("Brightness must be between 1 and 100, the minimum not above the maximum")
+	}
+
+	if m.sat < 0 || m.sat > 100 {
+		return errors.New("Saturation must be between 0 and 100")
+	}
+
+	return nil
+}
+
+// frame returns the frame matching the features of a window of audio
+func (m *audioMapping) frame(f audio.Features) (yeelight.Frame, error) {
+	var level float64
+	switch m.bright {
+	case "rms":
+		level = f.RMS
+	case "bass":
+		level = f.Bass
+	case "mid":
+		level = f.Mid
+	case "treble":
+		level = f.Treble
+	default:
+		return yeelight.Frame{}, errors.New("Brightness source invalid. Please check help")
+	}
+
+	switch m.hue {
+	case "beat":
+		if f.Beat {
+			m.currentHue = math.Mod(m.currentHue+m.hueStep, 360)
+		}
+	case "centroid":
+		// from red for low sounds to purple for high ones, on a log scale
+		if f.Centroid > 0 {
+			position := (math.Log2(f.Centroid) - math.Log2(100)) / (math.Log2(8000) - math.Log2(100))
+			m.currentHue = math.Max(0, math.Min(1, position)) * 300
+		}
+	default:
+		return yeelight.Frame{}, errors.New("Hue source invalid. Please check help")
+	}
+
+	bright := float64(m.minBright) + float64(m.maxBright-m.minBright)*level
+	return yeelight.Frame{
+		Bright: int(math.Max(1, math.Min(100, math.Round(bright)))),
+		RGB:    yeelight.HSVToRGB(m.currentHue, m.sat),
+	}, nil
+}
+
+var (
+	// audio input, a WAV file or - for raw PCM on stdin
+	audioInput string
+	// format of raw PCM input
+	audioRate, audioChannels int
+	// frames sent per second
+	audioFPS float64
+	// delay added to the lights, negative to compensate their latency
+	audioLatency time.Duration
+
+	// mapping of the audio features to the frames
+	audioMap = audioMapping{}
+)
+
+var audioCmd = &cobra.Command{
+	Use:   "audio [name/IP...]",
+	Short: "Make lights react to music",
+	Long: `Make lights react to music read from a WAV file, or from raw PCM audio
+(signed 16-bit little endian) on stdin. The audio is analyzed on this machine
+and the lights are driven through music mode, no sound hardware is needed.
+The analysis runs in real time, start the playback at the same time and use
+--latency to compensate the delay of the lights or of the player.
+"bright" is the feature driving the brightness: rms (loudness), bass, mid or treble.
+"hue" is the feature driving the color:
+	"beat" rotates the hue by --hue-step on each beat.
+	"centroid" goes from red for low sounds to purple for high ones.`,
+	Example: `yeego audio bedroom --input song.wav
+ffmpeg -i song.mp3 -f s16le -ac 2 -ar 44100 - | yeego audio bedroom desk --input -
+parec --format=s16le --rate=44100 --channels=2 | yeego audio bedroom --input - --hue centroid`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeRest(completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := audioMap.validate(); err != nil {
+			return err
+		}
+		if audioFPS <= 0 || audioFPS > 60 {
+			return errors.New("Frame rate must be between 0 and 60")
+		}
+
+		var targets []*yeelight.Yeelight
+		for _, arg := range args {
+			matched, err := resolveTargets(arg)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, matched...)
+		}
+
+		var stream *audio.Stream
+		var err error
+		if audioInput == "-" {
+			stream, err = audio.NewRawStream(os.Stdin, audioRate, audioChannels)
+		} else {
+			var file *os.File
+			if file, err = os.Open(audioInput); err != nil {
+				return err
+			}
+			defer file.Close()
+			stream, err = audio.NewWAVStream(file)
+		}
+		if err != nil {
+			return err
+		}
+
+		hop := int(float64(stream.Rate) / audioFPS)
+		if hop < 1 {
+			return fmt.Errorf("Frame rate too high for audio at %d Hz", stream.Rate)
+		}
+
+		renderers := make([]*yeelight.FrameRenderer, len(targets))
+		for i, light := range targets {
+			sender := yeelight.NewSender(light, "")
+			defer sender.Close()
+			renderers[i] = yeelight.NewFrameRenderer(sender)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		interval := time.Duration(float64(time.Second) * float64(hop) / float64(stream.Rate))
+		analyzer := audio.NewAnalyzer(stream.Rate, audioFPS)
+		samples := make([]float64, hop)
+
+		info("Playing %s at %d Hz, press Ctrl+C to stop\n", audioInput, stream.Rate)
+		start := time.Now()
+		for i := 0; ; i++ {
+			n, err := stream.Read(samples)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			frame, err := audioMap.frame(analyzer.Analyze(samples[:n]))
+			if err != nil {
+				return err
+			}
+
+			// frames computed ahead, from files, wait for their time
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(start.Add(time.Duration(i)*interval + audioLatency))):
+			}
+
+			for _, r := range renderers {
+				if err := r.Render(ctx, frame, interval); err != nil {
+					return err
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	audioCmd.Flags().StringVarP(&audioInput, "input", "i", "", "WAV file to read, - for raw PCM on stdin")
+	audioCmd.MarkFlagRequired("input")
+	audioCmd.Flags().IntVar(&audioRate, "rate", 44100, "Sample rate of raw PCM input")
+	audioCmd.Flags().IntVar(&audioChannels, "channels", 2, "Channels of raw PCM input")
+	audioCmd.Flags().Float64Var(&audioFPS, "fps", 20, "Frames sent per second")
+	audioCmd.Flags().DurationVar(&audioLatency, "latency", 0, "Delay added to the lights, negative to send the frames earlier")
+	audioCmd.Flags().StringVar(&audioMap.bright, "bright", "rms", "Feature driving the brightness: rms, bass, mid or treble")
+	audioCmd.Flags().StringVar(&audioMap.hue, "hue", "beat", "Feature driving the color: beat or centroid")
+	audioCmd.RegisterFlagCompletionFunc("bright", completeFlag(completeValues("rms", "bass", "mid", "treble")))
+	audioCmd.RegisterFlagCompletionFunc("hue", completeFlag(completeValues("beat", "centroid")))
+	audioCmd.Flags().IntVar(&audioMap.minBright, "min-bright", 5, "Brightness of silence")
+	audioCmd.Flags().IntVar(&audioMap.maxBright, "max-bright", 100, "Brightness of the loudest sounds")
+	audioCmd.Flags().Float64Var(&audioMap.hueStep, "hue-step", 60, "Hue rotation on each beat, in degrees")
+	audioCmd.Flags().Float64Var(&audioMap.sat, "sat", 100, "Saturation of the colors")
+
+	rootCmd.AddCommand(audioCmd)
+}
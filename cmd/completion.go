@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:         "completion [bash|zsh|fish|powershell]",
+	Annotations: configOnly,
+	Short:       "Generate the completion script of a shell",
+	Long: `Generate the completion script of a shell, which completes the commands,
+the saved lights, groups, rooms, tags and scenes, and the values of the commands.
+
+Bash, with the bash-completion package:
+	source <(yeego completion bash)
+Zsh:
+	yeego completion zsh > "${fpath[1]}/_yeego"
+Fish:
+	yeego completion fish > ~/.config/fish/completions/yeego.fish
+PowerShell:
+	yeego completion powershell | Out-String | Invoke-Expression`,
+	Example:   "yeego completion bash > /etc/bash_completion.d/yeego",
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	// the configuration is not needed to generate the script
+	PersistentPreRunE:  func(cmd *cobra.Command, args []string) error { return nil },
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		default:
+			return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+	},
+}
+
+// completer returns the values of an argument starting with toComplete
+type completer func(toComplete string) []string
+
+// completeArgs completes each argument with its completer, a nil completer completes file names
+func completeArgs(completers ...completer) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) >= len(completers) {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		c := completers[len(args)]
+		if c == nil {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+
+		return c(toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeRest completes the first arguments with their completers, and all the others with rest
+func completeRest(rest completer, first ...completer) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) < len(first) {
+			return completeArgs(first...)(cmd, args, toComplete)
+		}
+
+		return rest(toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeFlag completes the value of a flag
+func completeFlag(c completer) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return c(toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeValues completes fixed values, a value can be followed by a tab and its description
+func completeValues(values ...string) completer {
+	return func(toComplete string) []string {
+		var matched []string
+		for _, v := range values {
+			if strings.HasPrefix(v, toComplete) {
+				matched = append(matched, v)
+			}
+		}
+
+		return matched
+	}
+}
+
+// completeTargets completes the lights, groups, rooms and tags, after the commas of a list
+func completeTargets(toComplete string) []string {
+	// the hooks of the root command are not run by the completion, which
+	// reads the configuration without migrating it
+	if peekConfig() != nil {
+		return nil
+	}
+
+	prefix := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, toComplete = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	values := []string{"all\tall the saved lights"}
+	seen := map[string]bool{"all": true}
+	add := func(value, description string) {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value+"\t"+description)
+		}
+	}
+
+	for i := range lights {
+		address := strings.Split(lights[i].Location, ":")[0]
+		add(lights[i].Name, "light "+address)
+		add(address, "light "+lights[i].Name)
+	}
+	for _, alias := range sortedKeys(aliases) {
+		add(alias, "alias of "+aliases[alias])
+	}
+	for _, group := range sortedKeys(groups) {
+		add(group, "group of "+strings.Join(groups[group], ", "))
+	}
+	for _, label := range sortedKeys(meta) {
+		add(meta[label].Room, "room")
+		for _, tag := range meta[label].Tags {
+			add(tag, "tag")
+		}
+	}
+
+	matched := completeValues(values...)(toComplete)
+	for i := range matched {
+		matched[i] = prefix + matched[i]
+	}
+
+	return matched
+}
+
+// completeNone completes nothing, for the arguments which are new names
+func completeNone(toComplete string) []string {
+	return nil
+}
+
+// completeGroups completes the saved groups
+func completeGroups(toComplete string) []string {
+	if peekConfig() != nil {
+		return nil
+	}
+
+	return completeValues(sortedKeys(groups)...)(toComplete)
+}
+
+// completeAliases completes the saved aliases
+func completeAliases(toComplete string) []string {
+	if peekConfig() != nil {
+		return nil
+	}
+
+	return completeValues(sortedKeys(aliases)...)(toComplete)
+}
+
+// completeRooms completes the rooms of the lights
+func completeRooms(toComplete string) []string {
+	return completeMeta(toComplete, func(m lightMeta) []string { return []string{m.Room} })
+}
+
+// completeTags completes the tags of the lights
+func completeTags(toComplete string) []string {
+	return completeMeta(toComplete, func(m lightMeta) []string { return m.Tags })
+}
+
+func completeMeta(toComplete string, values func(lightMeta) []string) []string {
+	if peekConfig() != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range meta {
+		for _, v := range values(m) {
+			if v != "" {
+				seen[v] = true
+			}
+		}
+	}
+
+	return completeValues(sortedKeys(seen)...)(toComplete)
+}
+
+// completeScenes completes the saved scenes
+func completeScenes(toComplete string) []string {
+	if peekConfig() != nil {
+		return nil
+	}
+
+	return completeValues(sortedKeys(scenes)...)(toComplete)
+}
+
+// completeColors completes the named colors
+func completeColors(toComplete string) []string {
+	return completeValues(sortedKeys(namedColors)...)(toComplete)
+}
+
+// completeFlows completes the flow presets
+func completeFlows(toComplete string) []string {
+	return completeValues(sortedKeys(flowPresets)...)(toComplete)
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
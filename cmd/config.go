@@ -5,32 +5,55 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/julienrbrt/yeego/light/yeelight"
 	"github.com/spf13/cobra"
 )
 
 var getPropsCmd = &cobra.Command{
-	Use:   "props [name/IP]",
-	Short: "Get properties of a given light",
-	Args:  cobra.MinimumNArgs(1),
+	Use:               "props [name/IP]",
+	Short:             "Get properties of a given light",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeArgs(completeTargets),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		light, err := argToYeelight(args[0])
+		matched, err := resolveTargets(args[0])
 		if err != nil {
 			return err
 		}
 
-		err = light.GetProp()
-		if err != nil {
+		stateRefreshed = true
+		results := make([]result, len(matched))
+		errs := runOnLights(matched, func(i int, light *yeelight.Yeelight) error {
+			err := light.GetProp()
+			results[i] = newResult(light, currentAction, err)
+			if err == nil {
+				results[i] = results[i].withState(light)
+			}
 			return err
+		})
+		if len(matched) == 1 && errs[0] != nil && !structured() {
+			return errs[0]
 		}
 
-		lightJSON, err := json.Marshal(light)
+		err = render(results, func() {
+			for i, light := range matched {
+				if errs[i] != nil {
+					fmt.Printf("%s: %v\n", lightLabel(light), errs[i])
+					continue
+				}
+
+				lightJSON, _ := json.Marshal(light)
+				fmt.Printf("%s properties:\n%s\n", lightLabel(light), lightJSON)
+			}
+		}, stateTable(results))
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("%s properties:\n%s\n", args[0], lightJSON)
-		return nil
+		if len(matched) == 1 {
+			return errs[0]
+		}
 
+		return failedLights(errs)
 	},
 }
 
@@ -39,28 +62,22 @@ var setDefaultCmd = &cobra.Command{
 	Short: "Set state of given light as default",
 	Long: `Save state of given light as default.
 If the yeelight is turned off from power, the saved status is used when powered on`,
+	ValidArgsFunction: completeArgs(completeTargets),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		light, err := argToYeelight(args[0])
-		if err != nil {
+		return forEachLight(args[0], "settings saved as default", func(light *yeelight.Yeelight) error {
+			_, err := light.SetDefault()
 			return err
-		}
-
-		_, err = light.SetDefault()
-		if err != nil {
-			return err
-		}
-
-		fmt.Printf("%s settings saved as default\n", args[0])
-		return nil
+		})
 
 	},
 }
 
 var setNameCmd = &cobra.Command{
-	Use:     "set-name [name/IP] [new name]",
-	Short:   "Gives a name to a given light",
-	Example: "yeego set-name bedroom",
-	Args:    cobra.MinimumNArgs(1),
+	Use:               "set-name [name/IP] [new name]",
+	Short:             "Gives a name to a given light",
+	Example:           "yeego set-name bedroom",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeArgs(completeTargets),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		light, err := argToYeelight(args[0])
 		if err != nil {
@@ -76,8 +93,11 @@ var setNameCmd = &cobra.Command{
 			return err
 		}
 
-		fmt.Printf("%s name saved\n", args[0])
-		return nil
+		r := newResult(light, currentAction, nil)
+		r.Name = args[1]
+		return printResults([]result{r}, func() {
+			fmt.Printf("%s name saved\n", args[0])
+		})
 
 	},
 }
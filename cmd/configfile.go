@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/kardianos/osext"
+)
+
+// configVersion is the version of the configuration schema written by yeego
+// 1 is the object with lights, retry and layout, the array of lights before it has no version
+const configVersion = 2
+
+var (
+	// configPath is the configuration file, set by --config or YEEGO_CONFIG
+	configPath string
+
+	// aliases are other names of the lights, by name or IP
+	aliases = make(map[string]string)
+
+	// groups are named lists of lights, by name or IP
+	groups = make(map[string][]string)
+
+	// meta is the room and the tags of the lights, by name or IP
+	meta = make(map[string]lightMeta)
+
+	// scenes are named states which can be applied to any light
+	scenes = make(map[string]scene)
+
+	// defaults are the values of the global flags when they are not given
+	defaults = defaultsConfig{Retry: retry}
+)
+
+// config is the content of the configuration file
+type config struct {
+	Version  int                       `json:"version"`
+	Lights   []yeelight.Yeelight       `json:"lights"`
+	Aliases  map[string]string         `json:"aliases,omitempty"`
+	Groups   map[string][]string       `json:"groups,omitempty"`
+	Meta     map[string]lightMeta      `json:"meta,omitempty"`
+	Scenes   map[string]scene          `json:"scenes,omitempty"`
+	Layout   map[string]yeelight.Point `json:"layout,omitempty"`
+	Defaults defaultsConfig            `json:"defaults"`
+
+	// Retry is where the version 1 kept the retry policy
+	Retry *retryConfig `json:"retry,omitempty"`
+}
+
+// defaultsConfig are the defaults of the global flags as written in the configuration file
+type defaultsConfig struct {
+	Retry    retryConfig `json:"retry"`
+	Fallback bool        `json:"fallback,omitempty"`
+	Defer    duration    `json:"defer,omitempty"`
+}
+
+// scene is a state which can be applied to a light
+type scene struct {
+	Power  string `json:"power,omitempty"`
+	Bright int    `json:"bright,omitempty"`
+	CT     int    `json:"ct,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Flow   string `json:"flow,omitempty"`
+}
+
+// apply sets the light to the state of the scene
+func (s scene) apply(ctx context.Context, light *yeelight.Yeelight) error {
+	bright := s.Bright
+	if bright == 0 {
+		bright = 100
+	}
+
+	var err error
+	switch {
+	case s.Power == "off":
+		_, err = light.Call(ctx, "set_power", "off", "smooth", 500)
+	case s.Flow != "":
+		flow := s.Flow
+		if preset, ok := flowPresets[flow]; ok {
+			flow = preset
+		}
+
+		// the flow is repeated until an other command is sent
+		_, err = light.Call(ctx, "set_scene", "cf", 0, 0, flow)
+	case s.Color != "":
+		var color int
+		color, err = parseColor(s.Color)
+		if err == nil {
+			_, err = light.Call(ctx, "set_scene", "color", color, bright)
+		}
+	case s.CT != 0:
+		_, err = light.Call(ctx, "set_scene", "ct", s.CT, bright)
+	default:
+		_, err = light.Call(ctx, "set_power", "on", "smooth", 500)
+		if err == nil && s.Bright != 0 {
+			_, err = light.Call(ctx, "set_bright", s.Bright, "smooth", 500)
+		}
+	}
+
+	return err
+}
+
+// validate checks the scene can be applied before any light is changed
+func (s scene) validate() error {
+	switch s.Power {
+	case "", "on", "off":
+	default:
+		return fmt.Errorf("Invalid power %q, must be on or off", s.Power)
+	}
+
+	if s.Bright < 0 || s.Bright > 100 {
+		return fmt.Errorf("Invalid brightness %d, must be between 1 and 100", s.Bright)
+	}
+
+	if s.CT != 0 && (s.CT < 1700 || s.CT > 6500) {
+		return fmt.Errorf("Invalid color temperature %d, must be between 1700 and 6500", s.CT)
+	}
+
+	if s.Color != "" {
+		if _, err := parseColor(s.Color); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := flowPresets[s.Flow]; !ok && s.Flow != "" {
+		if _, err := yeelight.ParseFlow(s.Flow); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// defaultConfigPath returns the configuration file in the user configuration directory
+func defaultConfigPath() (string, error) {
+	if p := os.Getenv("YEEGO_CONFIG"); p != "" {
+		return p, nil
+	}
+
+	// XDG_CONFIG_HOME, or the equivalent of the platform
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "yeego", "config.json"), nil
+}
+
+// legacyConfigPath returns the configuration file of the previous versions, next to the binary
+func legacyConfigPath() (string, error) {
+	folderPath, err := osext.ExecutableFolder()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(folderPath, ".yeego"), nil
+}
+
+// loadConfig reads the configuration file, and migrates the legacy one when there is none yet
+func loadConfig() error {
+	return readConfig(true)
+}
+
+// peekConfig reads the configuration file, or the legacy one in place, without writing anything
+func peekConfig() error {
+	return readConfig(false)
+}
+
+// readConfig reads the configuration file, or the legacy one when there is none yet,
+// which is migrated to the new location if migrate is set
+func readConfig(migrate bool) error {
+	if configPath == "" {
+		p, err := defaultConfigPath()
+		if err != nil {
+			return fmt.Errorf("Cannot find the configuration directory: %w", err)
+		}
+		configPath = p
+	}
+
+	file, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return migrateLegacyConfig(migrate)
+	} else if err != nil {
+		return fmt.Errorf("Cannot read configuration: %w", err)
+	}
+
+	conf, err := parseConfig(file)
+	if err != nil {
+		return fmt.Errorf("Invalid configuration %s: %w", configPath, err)
+	}
+
+	useConfig(conf)
+	return nil
+}
+
+// migrateLegacyConfig reads the configuration file of the previous versions, and
+// copies it to the new location if migrate is set
+func migrateLegacyConfig(migrate bool) error {
+	legacy, err := legacyConfigPath()
+	if err != nil || legacy == configPath {
+		return nil
+	}
+
+	file, err := os.ReadFile(legacy)
+	if err != nil {
+		// nothing to migrate
+		return nil
+	}
+
+	conf, err := parseConfig(file)
+	if err != nil {
+		return fmt.Errorf("Invalid legacy configuration %s: %w", legacy, err)
+	}
+
+	useConfig(conf)
+	if !migrate {
+		return nil
+	}
+	if err := writeConfig(&lights); err != nil {
+		return fmt.Errorf("Cannot migrate configuration %s: %w", legacy, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Configuration migrated from %s to %s\n", legacy, configPath)
+	return nil
+}
+
+// parseConfig decodes any version of the configuration file and upgrades it to the current one
+func parseConfig(data []byte) (config, error) {
+	conf := config{Defaults: defaultsConfig{Retry: retry}}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return conf, nil
+	}
+
+	if data[0] == '[' {
+		// previous versions only saved the lights
+		if err := json.Unmarshal(data, &conf.Lights); err != nil {
+			return conf, syntaxError(data, err)
+		}
+		conf.Version = configVersion
+		return conf, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&conf); err != nil {
+		return conf, syntaxError(data, err)
+	}
+
+	switch {
+	case conf.Version > configVersion:
+		return conf, fmt.Errorf("Version %d is not supported, upgrade yeego to read it", conf.Version)
+	case conf.Version <= 1 && conf.Retry != nil:
+		conf.Defaults.Retry = *conf.Retry
+	case conf.Retry != nil:
+		return conf, errors.New(`Unknown field "retry", it belongs in "defaults"`)
+	}
+
+	conf.Version, conf.Retry = configVersion, nil
+
+	for name, s := range conf.Scenes {
+		if err := s.validate(); err != nil {
+			return conf, fmt.Errorf("Scene %s: %w", name, err)
+		}
+	}
+
+	return conf, nil
+}
+
+// syntaxError adds the line and column of a JSON error
+func syntaxError(data []byte, err error) error {
+	var offset int64
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		offset = syntax.Offset
+	case errors.As(err, &typ):
+		offset = typ.Offset
+	default:
+		return err
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n') - 1
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
+
+// useConfig replaces the loaded configuration
+func useConfig(conf config) {
+	lights, defaults = conf.Lights, conf.Defaults
+	retry = defaults.Retry
+
+	aliases, groups, scenes, layout = conf.Aliases, conf.Groups, conf.Scenes, conf.Layout
+	if aliases == nil {
+		aliases = make(map[string]string)
+	}
+	if groups == nil {
+		groups = make(map[string][]string)
+	}
+	meta = conf.Meta
+	if meta == nil {
+		meta = make(map[string]lightMeta)
+	}
+	if scenes == nil {
+		scenes = make(map[string]scene)
+	}
+	if layout == nil {
+		layout = make(map[string]yeelight.Point)
+	}
+}
+
+// Write the yeego config file
+func writeConfig(lights *[]yeelight.Yeelight) error {
+	// nothing to save, do not write any config file
+	if len(*lights) == 0 && len(layout) == 0 && len(aliases) == 0 && len(groups) == 0 && len(meta) == 0 && len(scenes) == 0 {
+		return nil
+	}
+
+	conf := config{
+		Version:  configVersion,
+		Lights:   *lights,
+		Aliases:  aliases,
+		Groups:   groups,
+		Meta:     meta,
+		Scenes:   scenes,
+		Layout:   layout,
+		Defaults: defaults,
+	}
+	conf.Defaults.Retry = retry
+	if conf.Lights == nil {
+		conf.Lights = []yeelight.Yeelight{}
+	}
+
+	data, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return err
+	}
+
+	// write then rename, so concurrent invocations never read a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(configPath), ".config-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), configPath)
+}
+
+// applyDefaults sets the global flags which are not given to the defaults of the configuration
+func applyDefaults(changed func(name string) bool) {
+	if !changed("fallback") {
+		fallback = defaults.Fallback
+	}
+
+	if !changed("defer") {
+		deferFor = time.Duration(defaults.Defer)
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"legacy array", `[{"location": "10.0.0.1:55443", "name": "desk"}]`, ""},
+		{"version 1 retry", `{"version": 1, "lights": [], "retry": {"max_attempts": 5, "base_delay": "1s", "max_delay": "4s", "jitter": 0}}`, ""},
+		{"version 2 retry", `{"version": 2, "lights": [], "retry": {"max_attempts": 5}}`, `Unknown field "retry", it belongs in "defaults"`},
+		{"unknown field", `{"version": 2, "lights": [], "colours": {}}`, `json: unknown field "colours"`},
+		{"newer version", `{"version": 3}`, "Version 3 is not supported"},
+		{"syntax", "{\n  \"version\": 2,\n  \"lights\": [,]\n}", "line 3, column 14: invalid character ','"},
+		{"type", "{\n  \"version\": \"2\"\n}", "line 2, column 16: json: cannot unmarshal string"},
+		{"invalid scene", `{"version": 2, "scenes": {"night": {"power": "dim"}}}`, "Scene night:"},
+	} {
+		conf, err := parseConfig([]byte(test.data))
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.HasPrefix(err.Error(), test.err)):
+			t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+		case err == nil && (conf.Version != configVersion || conf.Retry != nil):
+			t.Errorf("%s: got version %d and retry %v, want version %d without retry", test.name, conf.Version, conf.Retry, configVersion)
+		}
+	}
+
+	conf, _ := parseConfig([]byte(`[{"location": "10.0.0.1:55443", "name": "desk"}]`))
+	if len(conf.Lights) != 1 || conf.Lights[0].Name != "desk" {
+		t.Errorf("legacy array: got lights %+v", conf.Lights)
+	}
+
+	conf, _ = parseConfig([]byte(`{"version": 1, "retry": {"max_attempts": 5, "base_delay": "1s"}}`))
+	if conf.Defaults.Retry.MaxAttempts != 5 || time.Duration(conf.Defaults.Retry.BaseDelay) != time.Second {
+		t.Errorf("version 1: got retry %+v in the defaults", conf.Defaults.Retry)
+	}
+}
+
+// useConfigPath points the configuration to path during the test
+func useConfigPath(t *testing.T, path string) {
+	t.Helper()
+
+	previous := configPath
+	configPath = path
+	t.Cleanup(func() { configPath = previous })
+}
+
+// writeLegacyConfig writes the legacy configuration next to the test binary
+func writeLegacyConfig(t *testing.T, data string) {
+	t.Helper()
+
+	legacy, err := legacyConfigPath()
+	if err != nil {
+		t.Skip(err)
+	}
+	if err := os.WriteFile(legacy, []byte(data), 0600); err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { os.Remove(legacy) })
+}
+
+func TestMigrateLegacyConfig(t *testing.T) {
+	writeLegacyConfig(t, `[{"location": "10.0.0.1:55443", "name": "desk"}]`)
+	path := filepath.Join(t.TempDir(), "yeego", "config.json")
+	useConfigPath(t, path)
+
+	// the completion reads the legacy configuration in place
+	if err := peekConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if len(lights) != 1 || lights[0].Name != "desk" {
+		t.Fatalf("got lights %+v", lights)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("configuration written by a read only load: %v", err)
+	}
+
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"version": 2`) || !strings.Contains(string(data), `"name": "desk"`) {
+		t.Fatalf("got migrated configuration %s", data)
+	}
+}
+
+func TestLoadConfigError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("{\n  \"lights\": [}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	useConfigPath(t, path)
+
+	err := loadConfig()
+	if want := "Invalid configuration " + path + ": line 2, column 14:"; err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got %v, want %s", err, want)
+	}
+}
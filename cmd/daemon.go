@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/julienrbrt/yeego/internal/daemon"
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// socketPath is the Unix socket of the daemon
+	socketPath string
+
+	// direct sends the commands to the lights even when the daemon is running
+	direct bool
+
+	// viaDaemon is set when the commands are sent through the daemon
+	viaDaemon bool
+
+	// daemonRate is the number of requests per minute sent to each light by the daemon
+	daemonRate int
+
+	// daemonReconnect is the time between two connections to an unreachable light
+	daemonReconnect time.Duration
+)
+
+var daemonCmd = &cobra.Command{
+	Use:         "daemon",
+	Annotations: configOnly,
+	Short:       "Keep the lights connected and serve the other commands",
+	Long: `Keep a connection open to each light and serve the other commands on a Unix socket.
+While the daemon runs, the commands are sent through it: the state of the lights is
+read from the cache kept current by their notifications, the requests to each light
+are limited to stay under their quota, and the daemon saves the state of the lights
+in the configuration instead of each command.
+The commands fall back to sending to the lights directly when the daemon is not running,
+or with --direct. Deferred commands, with --defer, are always sent directly.
+
+The daemon serves JSON-RPC 2.0 on the socket, one object by line, with the methods:
+	light.call   {"location": "192.168.1.24:55443", "method": "set_power", "params": ["on"]}
+	light.list   the lights of the daemon, with their state
+	daemon.stop  stop the daemon`,
+	Example: `yeego daemon &
+yeego on bedroom
+yeego daemon status
+yeego daemon stop`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if client, err := daemon.Dial(socketPath); err == nil {
+			client.Close()
+			return fmt.Errorf("A daemon is already listening on %s", socketPath)
+		}
+
+		// the socket of a daemon which did not stop properly
+		os.Remove(socketPath)
+		ln, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return fmt.Errorf("Cannot listen on %s: %w", socketPath, err)
+		}
+		defer os.Remove(socketPath)
+		if err := os.Chmod(socketPath, 0600); err != nil {
+			ln.Close()
+			return err
+		}
+
+		pool := daemon.NewPool()
+		defer pool.Close()
+
+		client := yeelight.NewClient(
+			yeelight.WithDialer(pool),
+			yeelight.WithRateLimiter(yeelight.NewRateLimiter(daemonRate, time.Minute)),
+			yeelight.WithRetryPolicy(retry.policy()),
+		)
+		if verbose {
+			client.Use(yeelight.WireLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		registry := daemon.NewRegistry(client, lights, daemonReconnect)
+		go registry.Run(ctx)
+
+		saved := make(chan struct{})
+		go func() {
+			defer close(saved)
+			saveLights(ctx, registry)
+		}()
+
+		info("Daemon listening on %s\n", socketPath)
+		err = daemon.Serve(ctx, ln, registry)
+		stop()
+		<-saved
+
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the lights kept by the daemon",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := daemon.Dial(socketPath)
+		if err != nil {
+			return fmt.Errorf("No daemon listening on %s", socketPath)
+		}
+		defer client.Close()
+
+		var entries []daemon.LightStatus
+		if err := client.Call(context.Background(), "light.list", nil, &entries); err != nil {
+			return err
+		}
+
+		return render(entries, func() {
+			fmt.Printf("%v lights kept by the daemon on %s:\n", len(entries), socketPath)
+			for _, e := range entries {
+				fmt.Printf("- %s\n", daemonEntry(e))
+			}
+		}, func(w io.Writer) {
+			fmt.Fprintln(w, "NAME\tADDRESS\tCONNECTED\tPOWER\tBRIGHT\tUPDATED")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\n", e.Light.Name, address(&e.Light), e.Connected,
+					e.Light.Power, number(e.Light.Bright), updatedAgo(e.Updated))
+			}
+		})
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the daemon",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := daemon.Dial(socketPath)
+		if err != nil {
+			return fmt.Errorf("No daemon listening on %s", socketPath)
+		}
+		defer client.Close()
+
+		if err := client.Call(context.Background(), "daemon.stop", nil, nil); err != nil {
+			return err
+		}
+
+		info("Daemon stopped\n")
+		return nil
+	},
+}
+
+// useDaemon sends the commands through the daemon when it is running
+func useDaemon(cmd *cobra.Command) {
+	if direct || deferFor > 0 || cmd.HasParent() && cmd.Parent() == daemonCmd || cmd == daemonCmd {
+		return
+	}
+
+	client, err := daemon.Dial(socketPath)
+	if err != nil {
+		return
+	}
+
+	yeelight.Use(client.Middleware())
+	viaDaemon = true
+}
+
+// saveLights writes the state of the lights of the registry to the configuration
+// when it changes, and once stopped
+func saveLights(ctx context.Context, registry *daemon.Registry) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var last []daemon.LightStatus
+	save := func() {
+		current := registry.Lights()
+		if reflect.DeepEqual(states(current), states(last)) {
+			return
+		}
+
+		if err := mergeLights(current); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot save the lights: %v\n", err)
+			return
+		}
+		last = current
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
+
+// mergeLights reads the configuration again, as other commands may have changed
+// it, and updates the lights known by the daemon
+func mergeLights(current []daemon.LightStatus) error {
+	if err := loadConfig(); err != nil {
+		return err
+	}
+
+	for _, s := range current {
+		// the lights never reached are not saved
+		if s.Updated.IsZero() {
+			continue
+		}
+
+		found := false
+		for i := range lights {
+			if lights[i].Location == s.Light.Location || (s.Light.ID != "" && lights[i].ID == s.Light.ID) {
+				lights[i], found = s.Light, true
+				break
+			}
+		}
+		if !found {
+			lights = append(lights, s.Light)
+		}
+	}
+
+	return writeConfig(&lights)
+}
+
+func states(statuses []daemon.LightStatus) []yeelight.Yeelight {
+	lights := make([]yeelight.Yeelight, len(statuses))
+	for i, s := range statuses {
+		lights[i] = s.Light
+	}
+
+	return lights
+}
+
+// daemonEntry describes a light kept by the daemon
+func daemonEntry(s daemon.LightStatus) string {
+	var b strings.Builder
+	if s.Light.Name != "" {
+		fmt.Fprintf(&b, "%s (%s)", s.Light.Name, address(&s.Light))
+	} else {
+		b.WriteString(address(&s.Light))
+	}
+
+	if !s.Connected {
+		b.WriteString(": offline")
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, ": %s, brightness %d, updated %s", s.Light.Power, s.Light.Bright, updatedAgo(s.Updated))
+	return b.String()
+}
+
+func updatedAgo(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return time.Since(t).Truncate(time.Second).String() + " ago"
+}
+
+func init() {
+	daemonCmd.Flags().IntVar(&daemonRate, "rate", 60, "Requests per minute sent to each light, the lights allow 60")
+	daemonCmd.Flags().DurationVar(&daemonReconnect, "reconnect", 5*time.Second, "Time between two connections to an unreachable light")
+
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
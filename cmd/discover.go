@@ -9,49 +9,75 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// discoverTimeout is how long discover waits for the lights to answer
+var discoverTimeout time.Duration
+
 var discoverCmd = &cobra.Command{
 	Use:   "discover",
 	Short: "Discover Yeelight bulbs on your network",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		lights, err := yeelight.Discover(time.Duration(timeout))
+		lights, err := yeelight.Discover(discoverTimeout)
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("%v Yeelight found on your network.\n", len(lights))
-
 		//write configuration file
 		err = writeConfig(&lights)
-		return err
+		if err != nil {
+			return err
+		}
+
+		results := make([]result, len(lights))
+		for i := range lights {
+			results[i] = newResult(&lights[i], currentAction, nil).withState(&lights[i])
+		}
+
+		return render(results, func() {
+			fmt.Printf("%v Yeelight found on your network.\n", len(lights))
+		}, stateTable(results))
 	},
 }
 
 var listCmd = &cobra.Command{
 	Use:     "list",
 	Short:   "List the saved Yeelight",
-	Long:    "List the saved Yeelight from the .yeego configuration file",
+	Long:    "List the saved Yeelight from the configuration file",
 	Example: "yeego list",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// no light found
-		if len(lights) == 0 {
-			fmt.Println("No Yeelight saved in configuration")
-			return nil
+		results := make([]result, len(lights))
+		for i := range lights {
+			results[i] = newResult(&lights[i], currentAction, nil).withState(&lights[i])
 		}
 
-		fmt.Printf("%v Yeelight saved in configuration:\n", len(lights))
-		for i, light := range lights {
-			if light.Name == "" {
-				light.Name = "Unknown [no name]"
+		return render(results, func() {
+			// no light found
+			if len(lights) == 0 {
+				fmt.Println("No Yeelight saved in configuration")
+				return
 			}
-			fmt.Printf("- %d: %s on %v\n", i+1, light.Name, strings.Split(light.Location, ":")[0])
-		}
 
-		return nil
+			fmt.Printf("%v Yeelight saved in configuration:\n", len(lights))
+			for i, light := range lights {
+				if light.Name == "" {
+					light.Name = "Unknown [no name]"
+				}
+				fmt.Printf("- %d: %s on %v", i+1, light.Name, strings.Split(light.Location, ":")[0])
+				if m, ok := meta[lightLabel(&lights[i])]; ok {
+					if m.Room != "" {
+						fmt.Printf(" in %s", m.Room)
+					}
+					if len(m.Tags) > 0 {
+						fmt.Printf(" [%s]", strings.Join(m.Tags, ", "))
+					}
+				}
+				fmt.Println()
+			}
+		}, stateTable(results))
 	},
 }
 
 func init() {
-	discoverCmd.Flags().DurationVarP(&timeout, "timeout", "t", time.Second, "Timeout for discover")
+	discoverCmd.Flags().DurationVarP(&discoverTimeout, "timeout", "t", time.Second, "Timeout for discover")
 	rootCmd.AddCommand(discoverCmd)
 	rootCmd.AddCommand(listCmd)
 }
@@ -2,91 +2,77 @@ package cmd
 
 import (
 	"errors"
-	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/julienrbrt/yeego/light/yeelight"
 	"github.com/spf13/cobra"
 )
 
+// effectDuration is the duration of the transitions of set-temp, set-color and set-bright
+var effectDuration time.Duration
+
 var temperatureCmd = &cobra.Command{
 	Use:   "set-temp [name/IP] [color temperature in k]",
 	Short: "Change the color temperature of a given light",
 	Long: `Change the color temperature of a given light
 The range is from 1700 to 6500 (k)`,
-	Example: "yeego set-temp bedroom 3500",
-	Args:    cobra.MinimumNArgs(2),
+	Example:           "yeego set-temp bedroom 3500",
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeArgs(completeTargets),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		light, err := argToYeelight(args[0])
-		if err != nil {
-			return err
-		}
-
 		color, err := strconv.Atoi(args[1])
 		if err != nil {
 			return errors.New("Color temperature is mandatory")
 		}
 
-		_, err = light.SetCtAbx(color, int(timeout.Milliseconds()))
-		if err != nil {
+		return forEachLight(args[0], "color temperature updated", func(light *yeelight.Yeelight) error {
+			_, err := light.SetCtAbx(color, int(effectDuration.Milliseconds()))
 			return err
-		}
-
-		fmt.Printf("%s color temperature updated\n", args[0])
-		return nil
+		})
 	},
 }
 
 var colorCmd = &cobra.Command{
-	Use:     "set-color [name/IP] [color in hex]",
-	Short:   "Change the color of a given light",
-	Example: "yeego set-color bedroom ffffff",
-	Args:    cobra.MinimumNArgs(2),
+	Use:   "set-color [name/IP] [color in hex]",
+	Short: "Change the color of a given light",
+	Long: `Change the color of a given light
+The color is in hexadecimal, or one of the named colors: red, orange, yellow,
+green, cyan, blue, purple, magenta, pink and white`,
+	Example: `yeego set-color bedroom ffffff
+yeego set-color bedroom orange`,
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeArgs(completeTargets, completeColors),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		light, err := argToYeelight(args[0])
+		value, err := parseColor(args[1])
 		if err != nil {
 			return err
 		}
 
-		value, err := strconv.ParseInt(args[1], 16, 32)
-		if err != nil {
-			return errors.New("Color is mandatory")
-		}
-
-		_, err = light.SetRGBhex(int(value), int(timeout.Milliseconds()))
-		if err != nil {
+		return forEachLight(args[0], "color updated", func(light *yeelight.Yeelight) error {
+			_, err := light.SetRGBhex(value, int(effectDuration.Milliseconds()))
 			return err
-		}
-
-		fmt.Printf("%s color updated\n", args[0])
-		return nil
+		})
 	},
 }
 
 var brightnessCmd = &cobra.Command{
-	Use:     "set-bright [name/IP] [level]",
-	Short:   "Change the brightness of a given light",
-	Example: "yeego set-bright bedroom 75",
-	Args:    cobra.MinimumNArgs(2),
+	Use:               "set-bright [name/IP] [level]",
+	Short:             "Change the brightness of a given light",
+	Example:           "yeego set-bright bedroom 75",
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeArgs(completeTargets),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		light, err := argToYeelight(args[0])
-		if err != nil {
-			return err
-		}
-
 		brightness, err := strconv.Atoi(args[1])
 		if err != nil {
 			return errors.New("Brightness is mandatory")
 		}
 
-		_, err = light.SetBright(brightness, int(timeout.Milliseconds()))
-		if err != nil {
+		return forEachLight(args[0], "brightness updated", func(light *yeelight.Yeelight) error {
+			_, err := light.SetBright(brightness, int(effectDuration.Milliseconds()))
 			return err
-		}
-
-		fmt.Printf("%s brightness updated\n", args[0])
-		return nil
+		})
 	},
 }
 
@@ -100,24 +86,17 @@ yeego adjust bedroom decrease bright
 yeego adjust bedroom increase ct
 yeego adjust bedroom decrease ct
 yeego adjust bedroom cirle color`,
-	Args: cobra.MinimumNArgs(3),
+	Args:              cobra.MinimumNArgs(3),
+	ValidArgsFunction: completeArgs(completeTargets, completeValues("increase", "decrease", "circle"), completeValues("bright", "ct", "color")),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		light, err := argToYeelight(args[0])
-		if err != nil {
-			return err
-		}
-
 		if args[1] == "" || args[2] == "" {
 			return errors.New("Action and property are mandatory")
 		}
 
-		_, err = light.SetAdjust(args[1], args[2])
-		if err != nil {
+		return forEachLight(args[0], "adjusted", func(light *yeelight.Yeelight) error {
+			_, err := light.SetAdjust(args[1], args[2])
 			return err
-		}
-
-		fmt.Printf("%s adjusted\n", args[0])
-		return nil
+		})
 	},
 }
 
@@ -137,16 +116,14 @@ var colorFlowCmd = &cobra.Command{
 	So for above request example, it means: change CT to 2700K & maximum brightness
 	gradually in 1000ms, then change color to red & 10% \brightness gradually in 500ms, then
 	stay at this state for 5 seconds, then change CT to 5000K & minimum brightness gradually in
-	500ms. After 4 changes reached, stopped the flow and power off the smart LED`,
+	500ms. After 4 changes reached, stopped the flow and power off the smart LED
+	The expression can also be one of the presets: candle, pulse, police, disco and sunrise.`,
 	Example: `yeego start-cf bedroom 4 turn-off 1000,2,2700,100
-yeego start-cf bedroom 4 recover-state 100,2,2700,100,50,1,255,10,500,7,0,0,500,2,5000,1`,
-	Args: cobra.MinimumNArgs(4),
+yeego start-cf bedroom 4 recover-state 100,2,2700,100,50,1,255,10,500,7,0,0,500,2,5000,1
+yeego start-cf bedroom 0 recover-state candle`,
+	Args:              cobra.MinimumNArgs(4),
+	ValidArgsFunction: completeArgs(completeTargets, completeValues("0\tinfinite loop"), completeValues("recover-state", "keep-state", "turn-off"), completeFlows),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		light, err := argToYeelight(args[0])
-		if err != nil {
-			return err
-		}
-
 		count, err := strconv.Atoi(args[1])
 		if err != nil {
 			return errors.New("The number of time to repeat the flow is mandatory")
@@ -164,59 +141,60 @@ yeego start-cf bedroom 4 recover-state 100,2,2700,100,50,1,255,10,500,7,0,0,500,
 			return errors.New("Action invalid. Please check help")
 		}
 
-		exp := strings.Split(args[3], ",")
-		if len(exp) < 4 {
-			return errors.New("Action invalid. Please check help")
-		}
-
-		for i := range exp {
-			tmp, err := strconv.Atoi(exp[i])
-			if err != nil {
-				return errors.New("All the numbers of the flow should be integer: [duration, mode, value, brightness]")
-			}
-
-			// convert seconds to ms
-			if (i % 4) == 0 {
-				exp[i] = strconv.FormatInt(int64(tmp*1000), 10)
+		expression, ok := flowPresets[args[3]]
+		if !ok {
+			if expression, err = secondsToMs(args[3]); err != nil {
+				return err
 			}
 		}
 
-		_, err = light.StartCf(count, action, strings.Join(exp, ","))
+		flow, err := yeelight.ParseFlow(expression)
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("%s color flow started\n", args[0])
-		return nil
-
+		return forEachLight(args[0], "color flow started", func(light *yeelight.Yeelight) error {
+			_, err := light.StartCf(count, action, flow.String())
+			return err
+		})
 	},
 }
 
-var stopColorFlowCmd = &cobra.Command{
-	Use:   "stop-cf [name/IP]",
-	Short: "Stop a running color flow (cf)",
-	Args:  cobra.MinimumNArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		light, err := argToYeelight(args[0])
+// secondsToMs converts the durations of a flow expression from seconds to milliseconds
+func secondsToMs(expression string) (string, error) {
+	exp := strings.Split(expression, ",")
+	for i := range exp {
+		tmp, err := strconv.Atoi(exp[i])
 		if err != nil {
-			return err
+			return "", errors.New("All the numbers of the flow should be integer: [duration, mode, value, brightness]")
 		}
 
-		_, err = light.StopCf()
-		if err != nil {
-			return err
+		// convert seconds to ms
+		if (i % 4) == 0 {
+			exp[i] = strconv.FormatInt(int64(tmp*1000), 10)
 		}
+	}
 
-		fmt.Printf("%s color flow stopped\n", args[0])
-		return nil
+	return strings.Join(exp, ","), nil
+}
 
+var stopColorFlowCmd = &cobra.Command{
+	Use:               "stop-cf [name/IP]",
+	Short:             "Stop a running color flow (cf)",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeArgs(completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return forEachLight(args[0], "color flow stopped", func(light *yeelight.Yeelight) error {
+			_, err := light.StopCf()
+			return err
+		})
 	},
 }
 
 func init() {
-	temperatureCmd.Flags().DurationVarP(&timeout, "timeout", "t", 30*time.Millisecond, "Timeout temperature change effect")
-	colorCmd.Flags().DurationVarP(&timeout, "timeout", "t", 30*time.Millisecond, "Timeout color change effect")
-	brightnessCmd.Flags().DurationVarP(&timeout, "timeout", "t", 30*time.Millisecond, "Timeout brightness change effect")
+	temperatureCmd.Flags().DurationVarP(&effectDuration, "timeout", "t", 30*time.Millisecond, "Timeout temperature change effect")
+	colorCmd.Flags().DurationVarP(&effectDuration, "timeout", "t", 30*time.Millisecond, "Timeout color change effect")
+	brightnessCmd.Flags().DurationVarP(&effectDuration, "timeout", "t", 30*time.Millisecond, "Timeout brightness change effect")
 
 	rootCmd.AddCommand(temperatureCmd)
 	rootCmd.AddCommand(colorCmd)
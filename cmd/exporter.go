@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/julienrbrt/yeego/internal/daemon"
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// exporterListen is the address of the metrics server
+	exporterListen string
+
+	// exporterInterval is the time between two polls of the lights
+	exporterInterval time.Duration
+)
+
+var exporterCmd = &cobra.Command{
+	Use:   "exporter",
+	Short: "Expose the metrics of the lights to Prometheus",
+	Long: `Expose the metrics of the lights on /metrics, in the Prometheus text format.
+The state of each light is kept current by its notifications, and the lights are
+polled every --interval for their color flow and latency:
+	yeego_light_up                          1 while the light is reachable
+	yeego_light_power                       1 when on
+	yeego_light_brightness                  brightness, from 1 to 100
+	yeego_light_color_temperature_kelvin    color temperature
+	yeego_light_rgb                         color, as a 24 bits integer
+	yeego_light_color_mode                  1 for RGB, 2 for color temperature, 3 for HSV
+	yeego_light_flowing                     1 while a color flow runs
+	yeego_light_command_latency_seconds     round trip of the last command
+The requests sent by the exporter are counted by method, failed ones by error code,
+the connection errors having the code "connection":
+	yeego_commands_total
+	yeego_command_errors_total
+	yeego_quota_rejections_total`,
+	Example: `yeego exporter --listen :9797
+curl localhost:9797/metrics`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exporterInterval <= 0 {
+			return errors.New("Interval must be positive")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		exp := &exporter{
+			commands: make(map[string]int),
+			errors:   make(map[string]int),
+			latency:  make(map[string]time.Duration),
+			flowing:  make(map[string]bool),
+		}
+		// the exporter counts its own requests, so it does not go through the daemon
+		client := yeelight.NewClient(yeelight.WithMiddleware(yeelight.Timing(exp.observe)))
+		exp.registry = daemon.NewRegistry(client, lights, 5*time.Second)
+		go exp.registry.Run(ctx)
+		go exp.poll(ctx)
+
+		ln, err := net.Listen("tcp", exporterListen)
+		if err != nil {
+			return err
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+			exp.write(w, exp.registry.Lights())
+		})
+
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		context.AfterFunc(ctx, func() {
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdown)
+		})
+
+		info("Serving the metrics on http://%s/metrics\n", ln.Addr())
+		if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+
+		return nil
+	},
+}
+
+// exporter collects the metrics of the lights of the registry
+type exporter struct {
+	registry *daemon.Registry
+
+	mu       sync.Mutex
+	commands map[string]int           // by method
+	errors   map[string]int           // by error code
+	quota    int                      // rejections of the lights over their quota
+	latency  map[string]time.Duration // of the last command, by location
+	flowing  map[string]bool          // by location, read by the polls
+}
+
+// observe counts the requests sent to the lights
+func (e *exporter) observe(ex *yeelight.Exchange, elapsed time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.commands[ex.Command.Method]++
+	if ex.Duration > 0 {
+		elapsed = ex.Duration
+	}
+	e.latency[ex.Light.Location] = elapsed
+
+	if err == nil {
+		return
+	}
+
+	var devErr yeelight.Error
+	if !errors.As(err, &devErr) {
+		e.errors["connection"]++
+		return
+	}
+	e.errors[strconv.Itoa(devErr.Code)]++
+	if devErr.QuotaExceeded() {
+		e.quota++
+	}
+}
+
+// poll reads the color flow of the reachable lights, which the notifications do not keep
+func (e *exporter) poll(ctx context.Context) {
+	ticker := time.NewTicker(exporterInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, s := range e.registry.Lights() {
+			if !s.Connected {
+				continue
+			}
+
+			status, err := e.registry.Light(s.Light.Location).Status(ctx)
+			if err != nil {
+				continue
+			}
+
+			e.mu.Lock()
+			e.flowing[s.Light.Location] = status.Flowing
+			e.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// metric is a metric family of the Prometheus text format
+type metric struct {
+	name, help, kind string
+	samples          []sample
+}
+
+type sample struct {
+	labels [][2]string
+	value  float64
+}
+
+// write writes the metrics of the lights in the Prometheus text format
+func (e *exporter) write(w io.Writer, lights []daemon.LightStatus) {
+	light := func(name, help string) *metric {
+		return &metric{name: name, help: help, kind: "gauge"}
+	}
+	up := light("yeego_light_up", "Whether the light is reachable.")
+	power := light("yeego_light_power", "Whether the light is on.")
+	bright := light("yeego_light_brightness", "Brightness of the light, from 1 to 100.")
+	ct := light("yeego_light_color_temperature_kelvin", "Color temperature of the light.")
+	rgb := light("yeego_light_rgb", "Color of the light, as a 24 bits integer.")
+	mode := light("yeego_light_color_mode", "Color mode of the light: 1 for RGB, 2 for color temperature, 3 for HSV.")
+	flowing := light("yeego_light_flowing", "Whether a color flow runs on the light.")
+	latency := light("yeego_light_command_latency_seconds", "Round trip of the last command sent to the light.")
+
+	commands := &metric{name: "yeego_commands_total", help: "Requests sent to the lights, by method.", kind: "counter"}
+	failures := &metric{name: "yeego_command_errors_total", help: "Failed requests, by error code of the light or connection.", kind: "counter"}
+	quota := &metric{name: "yeego_quota_rejections_total", help: "Requests rejected by the lights over their quota.", kind: "counter"}
+
+	e.mu.Lock()
+	for _, s := range lights {
+		labels := [][2]string{{"id", s.Light.ID}, {"name", s.Light.Name}, {"address", address(&s.Light)}}
+		add := func(m *metric, value float64) {
+			m.samples = append(m.samples, sample{labels, value})
+		}
+
+		add(up, boolValue(s.Connected))
+		if d, ok := e.latency[s.Light.Location]; ok {
+			add(latency, d.Seconds())
+		}
+
+		// the lights never reached have no state
+		if s.Updated.IsZero() {
+			continue
+		}
+		add(power, boolValue(s.Light.Power == "on"))
+		add(bright, float64(s.Light.Bright))
+		add(ct, float64(s.Light.ColorTemp))
+		add(rgb, float64(s.Light.RGB))
+		add(mode, float64(s.Light.ColorMode))
+		if f, ok := e.flowing[s.Light.Location]; ok {
+			add(flowing, boolValue(f))
+		}
+	}
+
+	for _, method := range sortedKeys(e.commands) {
+		commands.samples = append(commands.samples, sample{[][2]string{{"method", method}}, float64(e.commands[method])})
+	}
+	for _, code := range sortedKeys(e.errors) {
+		failures.samples = append(failures.samples, sample{[][2]string{{"code", code}}, float64(e.errors[code])})
+	}
+	quota.samples = []sample{{value: float64(e.quota)}}
+	e.mu.Unlock()
+
+	for _, m := range []*metric{up, power, bright, ct, rgb, mode, flowing, latency, commands, failures, quota} {
+		m.write(w)
+	}
+}
+
+// write writes the metric family, with its help and type
+func (m *metric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+	sort.SliceStable(m.samples, func(i, j int) bool {
+		return labelString(m.samples[i].labels) < labelString(m.samples[j].labels)
+	})
+	for _, s := range m.samples {
+		fmt.Fprintf(w, "%s%s %s\n", m.name, labelString(s.labels), strconv.FormatFloat(s.value, 'g', -1, 64))
+	}
+}
+
+// labelString formats the labels of a sample, such as {id="0x01",name="desk"}
+func labelString(labels [][2]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, len(labels))
+	for i, l := range labels {
+		parts[i] = fmt.Sprintf(`%s="%s"`, l[0], escape.Replace(l[1]))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func init() {
+	exporterCmd.Flags().StringVar(&exporterListen, "listen", ":9797", "Address to listen on")
+	exporterCmd.Flags().DurationVar(&exporterInterval, "interval", 30*time.Second, "Time between two polls of the lights")
+	rootCmd.AddCommand(exporterCmd)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienrbrt/yeego/internal/daemon"
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+func TestExporterWrite(t *testing.T) {
+	exp := &exporter{
+		commands: make(map[string]int),
+		errors:   make(map[string]int),
+		latency:  make(map[string]time.Duration),
+		flowing:  map[string]bool{"10.0.0.1:55443": true},
+	}
+
+	desk := yeelight.Yeelight{ID: "0x01", Name: `desk "left"\`, Location: "10.0.0.1:55443", Power: "on", Bright: 40, ColorTemp: 2700, RGB: 255, ColorMode: 2}
+	exp.observe(&yeelight.Exchange{Light: &desk, Command: yeelight.Command{Method: "get_prop"}, Duration: 20 * time.Millisecond}, time.Second, nil)
+	exp.observe(&yeelight.Exchange{Light: &desk, Command: yeelight.Command{Method: "set_power"}}, 10*time.Millisecond, yeelight.Error{Code: -1, Message: "client quota exceeded"})
+	exp.observe(&yeelight.Exchange{Light: &yeelight.Yeelight{Location: "10.0.0.2:55443"}, Command: yeelight.Command{Method: "get_prop"}}, time.Second, errors.New("Cannot connect to light"))
+
+	var out bytes.Buffer
+	exp.write(&out, []daemon.LightStatus{
+		{Light: desk, Connected: true, Updated: time.Now()},
+		{Light: yeelight.Yeelight{Location: "10.0.0.2:55443"}},
+	})
+
+	for _, want := range []string{
+		"# HELP yeego_light_up Whether the light is reachable.\n# TYPE yeego_light_up gauge\n",
+		`yeego_light_up{id="0x01",name="desk \"left\"\\",address="10.0.0.1"} 1` + "\n",
+		`yeego_light_up{id="",name="",address="10.0.0.2"} 0` + "\n",
+		`yeego_light_brightness{id="0x01",name="desk \"left\"\\",address="10.0.0.1"} 40` + "\n",
+		`yeego_light_flowing{id="0x01",name="desk \"left\"\\",address="10.0.0.1"} 1` + "\n",
+		`yeego_light_command_latency_seconds{id="0x01",name="desk \"left\"\\",address="10.0.0.1"} 0.01` + "\n",
+		`yeego_light_command_latency_seconds{id="",name="",address="10.0.0.2"} 1` + "\n",
+		"# TYPE yeego_commands_total counter\n" + `yeego_commands_total{method="get_prop"} 2` + "\n" + `yeego_commands_total{method="set_power"} 1` + "\n",
+		`yeego_command_errors_total{code="-1"} 1` + "\n" + `yeego_command_errors_total{code="connection"} 1` + "\n",
+		"yeego_quota_rejections_total 1\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+
+	// the lights never reached have no state
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, `address="10.0.0.2"`) && !strings.HasPrefix(line, "yeego_light_up") && !strings.HasPrefix(line, "yeego_light_command_latency_seconds") {
+			t.Errorf("gauge of a light never reached: %s", line)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// fade options built from the flags
+	fadeOptions yeelight.FadeOptions
+	// gamma of the light output, 0 uses the calibration of the model
+	fadeGamma float64
+)
+
+var fadeCmd = &cobra.Command{
+	Use:   "fade [name/IP]",
+	Short: "Fade the brightness of a given light over minutes or hours",
+	Long: `Fade the brightness of a given light over minutes or hours, as a series of
+smooth steps following a perceptual brightness curve.
+"curve" is the scale on which the fade progresses linearly:
+	"cie" follows the CIE L* lightness, close to the perception of the eye.
+	"gamma" follows the light output raised to 1/2.2.
+	"linear" follows the brightness setting of the light.
+The fade goes on if the light is temporarily unreachable, and stops if the light
+is changed by someone else.`,
+	Example: `yeego fade bedroom --to 0 --over 30m --then off
+yeego fade bedroom --to 100 --over 1h --curve gamma`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeArgs(completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		matched, err := resolveTargets(args[0])
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		info("Fading %s over %v, press Ctrl+C to stop\n", args[0], fadeOptions.Over)
+		results := make([]result, len(matched))
+		errs := runOnLights(matched, func(i int, light *yeelight.Yeelight) error {
+			opts := fadeOptions
+			if fadeGamma > 0 {
+				cal := yeelight.CalibrationOf(light.Model)
+				cal.Gamma = fadeGamma
+				opts.Calibration = &cal
+			}
+
+			err := yeelight.Fade(ctx, light, opts)
+			results[i] = newResult(light, currentAction, err)
+			switch {
+			case errors.Is(err, context.Canceled):
+				return nil
+			case errors.Is(err, yeelight.ErrFadeCancelled):
+				info("%s was changed, fade stopped\n", lightLabel(light))
+				return nil
+			case err != nil:
+				return err
+			}
+
+			info("%s faded\n", lightLabel(light))
+			return nil
+		})
+		if len(matched) == 1 && !structured() {
+			return errs[0]
+		}
+
+		err = printResults(results, func() {
+			for i, light := range matched {
+				if errs[i] != nil {
+					fmt.Printf("%s: %v\n", lightLabel(light), errs[i])
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(matched) == 1 {
+			return errs[0]
+		}
+
+		return failedLights(errs)
+	},
+}
+
+func init() {
+	fadeCmd.Flags().IntVar(&fadeOptions.To, "to", 0, "Target brightness, 0 fades to the lowest brightness")
+	fadeCmd.Flags().DurationVar(&fadeOptions.Over, "over", 30*time.Minute, "Duration of the fade")
+	fadeCmd.Flags().StringVar((*string)(&fadeOptions.Curve), "curve", string(yeelight.CIECurve), "Brightness curve: cie, gamma or linear")
+	fadeCmd.Flags().DurationVar(&fadeOptions.Step, "step", 2*time.Second, "Minimum time between two steps")
+	fadeCmd.Flags().StringVar(&fadeOptions.Then, "then", "", "Power state at the end of the fade: on or off")
+	fadeCmd.RegisterFlagCompletionFunc("curve", completeFlag(completeValues("cie", "gamma", "linear")))
+	fadeCmd.RegisterFlagCompletionFunc("then", completeFlag(completeValues("on", "off")))
+	fadeCmd.Flags().Float64Var(&fadeGamma, "gamma", 0, "Gamma of the light output, overrides the calibration of the model")
+
+	rootCmd.AddCommand(fadeCmd)
+}
@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+// removeMode removes the given aliases or tags instead of adding them
+var removeMode bool
+
+var groupCmd = &cobra.Command{
+	Use:         "group",
+	Annotations: configOnly,
+	Short:       "Manage the groups of lights",
+	Long: `Manage the groups of lights saved in the configuration.
+A group can be given to any command instead of a light, as other targets:
+	a name, an alias or an IP,
+	a group, a room or a tag, which can be forced with "group:", "room:" or "tag:",
+	a glob on the names and IPs such as "kitchen-*",
+	"all" for all the saved lights,
+	a comma list of the above.`,
+	Example: `yeego group create upstairs bedroom bathroom
+yeego off upstairs
+yeego on kitchen-*,desk`,
+}
+
+var groupCreateCmd = &cobra.Command{
+	Use:               "create [group] [name/IP...]",
+	Short:             "Create a group of lights",
+	Example:           "yeego group create upstairs bedroom bathroom",
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeRest(completeTargets, completeNone),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, ok := groups[args[0]]; ok {
+			return fmt.Errorf("Group %s already exists, use `yeego group add`", args[0])
+		}
+
+		return saveGroup(args[0], nil, args[1:])
+	},
+}
+
+var groupAddCmd = &cobra.Command{
+	Use:               "add [group] [name/IP...]",
+	Short:             "Add lights to a group",
+	Example:           "yeego group add upstairs 192.168.1.24",
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeRest(completeTargets, completeGroups),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		members, ok := groups[args[0]]
+		if !ok {
+			return fmt.Errorf("Group %s not found", args[0])
+		}
+
+		return saveGroup(args[0], members, args[1:])
+	},
+}
+
+var groupRemoveCmd = &cobra.Command{
+	Use:   "remove [group] [name/IP...]",
+	Short: "Remove lights from a group, or the group itself",
+	Example: `yeego group remove upstairs bathroom
+yeego group remove upstairs`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeRest(completeTargets, completeGroups),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		members, ok := groups[args[0]]
+		if !ok {
+			return fmt.Errorf("Group %s not found", args[0])
+		}
+
+		if len(args) == 1 {
+			delete(groups, args[0])
+			if err := writeConfig(&lights); err != nil {
+				return err
+			}
+
+			return printGroups([]string{args[0]}, func() {
+				fmt.Printf("%s removed\n", args[0])
+			})
+		}
+
+		kept := members[:0]
+		for _, member := range members {
+			if !contains(args[1:], member) {
+				kept = append(kept, member)
+			}
+		}
+		groups[args[0]] = kept
+
+		if err := writeConfig(&lights); err != nil {
+			return err
+		}
+
+		return printGroups([]string{args[0]}, func() {
+			fmt.Printf("%s updated\n", args[0])
+		})
+	},
+}
+
+var groupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the groups of lights",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printGroups(sortedKeys(groups), func() {
+			if len(groups) == 0 {
+				fmt.Println("No group saved in configuration")
+				return
+			}
+
+			fmt.Printf("%v groups saved in configuration:\n", len(groups))
+			for _, name := range sortedKeys(groups) {
+				fmt.Printf("- %s: %s\n", name, strings.Join(groups[name], ", "))
+			}
+		})
+	},
+}
+
+var aliasCmd = &cobra.Command{
+	Use:         "alias [alias] [name/IP]",
+	Annotations: configOnly,
+	Short:       "Give an other name to a light",
+	Long: `Give an other name to a light, saved in the configuration.
+Without arguments, the saved aliases are listed.`,
+	Example: `yeego alias lamp 192.168.1.24
+yeego alias lamp --remove`,
+	ValidArgsFunction: completeArgs(completeAliases, completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return printAliases(sortedKeys(aliases), func() {
+				fmt.Printf("%v aliases saved in configuration:\n", len(aliases))
+				for _, alias := range sortedKeys(aliases) {
+					fmt.Printf("- %s: %s\n", alias, aliases[alias])
+				}
+			})
+		}
+
+		alias := strings.ToLower(args[0])
+		if removeMode {
+			if _, ok := aliases[alias]; !ok {
+				return fmt.Errorf("Alias %s not found", alias)
+			}
+			delete(aliases, alias)
+		} else {
+			if len(args) < 2 {
+				return errors.New("Please enter the light to give the alias to")
+			}
+
+			light, err := argToYeelight(args[1])
+			if err != nil {
+				return err
+			}
+			aliases[alias] = lightLabel(light)
+		}
+
+		if err := writeConfig(&lights); err != nil {
+			return err
+		}
+
+		return printAliases([]string{alias}, func() {
+			fmt.Printf("%s saved\n", alias)
+		})
+	},
+}
+
+var roomCmd = &cobra.Command{
+	Use:         "room [name/IP] [room]",
+	Annotations: configOnly,
+	Short:       "Set the room of given lights",
+	Long: `Set the room of given lights, which can then be used as a target.
+Without room, the lights are removed from their room.`,
+	Example: `yeego room desk office
+yeego off office`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeArgs(completeTargets, completeRooms),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		matched, err := resolveTargets(args[0])
+		if err != nil {
+			return err
+		}
+
+		room := ""
+		if len(args) > 1 {
+			room = args[1]
+		}
+
+		for _, light := range matched {
+			label := lightLabel(light)
+			m := meta[label]
+			m.Room = room
+			setMeta(label, m)
+		}
+
+		if err := writeConfig(&lights); err != nil {
+			return err
+		}
+
+		return printMeta(matched, func() {
+			fmt.Printf("%s room saved\n", args[0])
+		})
+	},
+}
+
+var tagCmd = &cobra.Command{
+	Use:         "tag [name/IP] [tag...]",
+	Annotations: configOnly,
+	Short:       "Tag given lights",
+	Long:        `Tag given lights, tags can then be used as targets.`,
+	Example: `yeego tag desk,shelf ambient
+yeego tag shelf ambient --remove
+yeego off ambient`,
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeRest(completeTags, completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		matched, err := resolveTargets(args[0])
+		if err != nil {
+			return err
+		}
+
+		for _, light := range matched {
+			label := lightLabel(light)
+			m := meta[label]
+
+			tags := m.Tags[:0:0]
+			for _, tag := range m.Tags {
+				if !contains(args[1:], tag) {
+					tags = append(tags, tag)
+				}
+			}
+			if !removeMode {
+				tags = append(tags, args[1:]...)
+			}
+
+			m.Tags = tags
+			setMeta(label, m)
+		}
+
+		if err := writeConfig(&lights); err != nil {
+			return err
+		}
+
+		return printMeta(matched, func() {
+			fmt.Printf("%s tags saved\n", args[0])
+		})
+	},
+}
+
+// saveGroup adds the lights to the members of a group after checking they can be found
+func saveGroup(name string, members, add []string) error {
+	for _, member := range add {
+		if _, err := resolvePart(member, map[string]bool{name: true}); err != nil {
+			return err
+		}
+
+		if !contains(members, member) {
+			members = append(members, member)
+		}
+	}
+
+	groups[name] = members
+	if err := writeConfig(&lights); err != nil {
+		return err
+	}
+
+	return printGroups([]string{name}, func() {
+		fmt.Printf("%s saved\n", name)
+	})
+}
+
+// groupEntry is a group as printed by the structured output formats
+type groupEntry struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+func printGroups(names []string, text func()) error {
+	entries := make([]groupEntry, len(names))
+	for i, name := range names {
+		entries[i] = groupEntry{Name: name, Members: groups[name]}
+	}
+
+	return render(entries, text, func(w io.Writer) {
+		fmt.Fprintln(w, "GROUP\tMEMBERS")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s\t%s\n", entry.Name, strings.Join(entry.Members, ","))
+		}
+	})
+}
+
+// aliasEntry is an alias as printed by the structured output formats
+type aliasEntry struct {
+	Alias string `json:"alias"`
+	Light string `json:"light,omitempty"`
+}
+
+func printAliases(names []string, text func()) error {
+	entries := make([]aliasEntry, len(names))
+	for i, name := range names {
+		entries[i] = aliasEntry{Alias: name, Light: aliases[name]}
+	}
+
+	return render(entries, text, func(w io.Writer) {
+		fmt.Fprintln(w, "ALIAS\tLIGHT")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s\t%s\n", entry.Alias, entry.Light)
+		}
+	})
+}
+
+// printMeta prints the room and the tags of the lights
+func printMeta(matched []*yeelight.Yeelight, text func()) error {
+	results := make([]result, len(matched))
+	for i, light := range matched {
+		results[i] = newResult(light, currentAction, nil)
+	}
+
+	return render(results, text, func(w io.Writer) {
+		fmt.Fprintln(w, "LIGHT\tADDRESS\tROOM\tTAGS")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, r.Address, r.Room, strings.Join(r.Tags, ","))
+		}
+	})
+}
+
+// setMeta saves the metadata of a light, removing it when empty
+func setMeta(label string, m lightMeta) {
+	if m.Room == "" && len(m.Tags) == 0 {
+		delete(meta, label)
+		return
+	}
+
+	meta[label] = m
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func init() {
+	aliasCmd.Flags().BoolVar(&removeMode, "remove", false, "Remove the alias")
+	tagCmd.Flags().BoolVar(&removeMode, "remove", false, "Remove the tags instead of adding them")
+
+	groupCmd.AddCommand(groupCreateCmd)
+	groupCmd.AddCommand(groupAddCmd)
+	groupCmd.AddCommand(groupRemoveCmd)
+	groupCmd.AddCommand(groupListCmd)
+	rootCmd.AddCommand(groupCmd)
+	rootCmd.AddCommand(aliasCmd)
+	rootCmd.AddCommand(roomCmd)
+	rootCmd.AddCommand(tagCmd)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// brightness added to the source brightness on the targets
+	mirrorOffset int
+	// hue rotation of the colors of each target
+	mirrorHueShift map[string]int
+	// duration of the transitions on the targets
+	mirrorTransition time.Duration
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror [source name/IP] [target name/IP...]",
+	Short: "Copy the state of a light to other lights in real time",
+	Long: `Copy the power, brightness and color of a source light to target lights
+in real time until interrupted. Music mode is used on the targets supporting it.`,
+	Example: `yeego mirror living-room desk shelf
+yeego mirror living-room desk --offset -20 --hue-shift desk=30`,
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeRest(completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source, err := argToYeelight(args[0])
+		if err != nil {
+			return err
+		}
+
+		var targets []yeelight.MirrorTarget
+		for _, arg := range args[1:] {
+			matched, err := resolveTargets(arg)
+			if err != nil {
+				return err
+			}
+
+			for _, light := range matched {
+				if light.Location == source.Location {
+					continue
+				}
+
+				target := yeelight.MirrorTarget{Light: light, BrightnessOffset: mirrorOffset}
+				if shift, ok := mirrorHueShift[arg]; ok {
+					target.Color = yeelight.HueShift(shift)
+				} else if shift, ok := mirrorHueShift[lightLabel(light)]; ok {
+					target.Color = yeelight.HueShift(shift)
+				}
+				targets = append(targets, target)
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		info("Mirroring %s, press Ctrl+C to stop\n", args[0])
+		err = yeelight.Mirror(ctx, source, targets, yeelight.MirrorOptions{Duration: mirrorTransition})
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+
+		return err
+	},
+}
+
+func init() {
+	mirrorCmd.Flags().DurationVarP(&mirrorTransition, "timeout", "t", 200*time.Millisecond, "Duration of the transitions on the targets")
+	mirrorCmd.Flags().IntVar(&mirrorOffset, "offset", 0, "Brightness added to the source brightness on the targets")
+	mirrorCmd.Flags().StringToIntVar(&mirrorHueShift, "hue-shift", nil, "Hue rotation in degrees of the colors of a target (target=degrees)")
+
+	rootCmd.AddCommand(mirrorCmd)
+}
@@ -0,0 +1,537 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/julienrbrt/yeego/internal/daemon"
+	"github.com/julienrbrt/yeego/internal/mqtt"
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// mqttBroker is the URL of the MQTT broker
+	mqttBroker string
+
+	// mqttUsername is the user of the broker, the password is read from YEEGO_MQTT_PASSWORD
+	mqttUsername string
+
+	// mqttClientID identifies yeego to the broker
+	mqttClientID string
+
+	// mqttPrefix is the prefix of the topics of the lights
+	mqttPrefix string
+
+	// mqttDiscoveryPrefix is the prefix of the Home Assistant discovery topics
+	mqttDiscoveryPrefix string
+)
+
+var mqttCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "Bridge the lights to an MQTT broker, with Home Assistant discovery",
+	Long: `Bridge the lights to an MQTT broker, in the Home Assistant JSON light schema:
+	<prefix>/<id>/state         the state of the light, retained
+	<prefix>/<id>/set           the commands to the light
+	<prefix>/<id>/availability  online while the light is reachable, retained
+	<prefix>/status             online while yeego is connected to the broker, retained
+The id of a light is its ID, or its address for the lights without ID.
+The lights are announced to Home Assistant in <discovery-prefix>/light/yeego_<id>/config,
+and again when Home Assistant comes online.
+The connection to the broker is reopened when lost. The password of the broker
+is read from YEEGO_MQTT_PASSWORD, or from the broker URL.`,
+	Example: `yeego mqtt --broker tcp://localhost:1883
+YEEGO_MQTT_PASSWORD=secret yeego mqtt --broker tls://broker.lan:8883 --username yeego
+mosquitto_pub -t yeego/0x0000000002dfb19a/set -m '{"state": "ON", "brightness": 40}'`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		bridge := &mqttBridge{
+			registry:  daemon.NewRegistry(yeelight.DefaultClient, lights, 5*time.Second),
+			commands:  make(chan mqtt.Message, 32),
+			announced: make(map[string]bool),
+			available: make(map[string]bool),
+		}
+		go bridge.registry.Run(ctx)
+		go bridge.execute(ctx)
+
+		return bridge.run(ctx)
+	},
+}
+
+// mqttBridge publishes the lights of the registry to the broker, and runs the
+// commands received from it
+type mqttBridge struct {
+	registry *daemon.Registry
+	commands chan mqtt.Message
+
+	mu        sync.Mutex
+	client    *mqtt.Client    // nil while disconnected
+	announced map[string]bool // the lights announced to Home Assistant on this connection
+	available map[string]bool // the availability published for each light
+}
+
+// haState is a state, or a command, in the Home Assistant JSON light schema
+type haState struct {
+	State      string   `json:"state,omitempty"`
+	Brightness *int     `json:"brightness,omitempty"`
+	ColorMode  string   `json:"color_mode,omitempty"`
+	ColorTemp  *int     `json:"color_temp,omitempty"` // in kelvin
+	Color      *haColor `json:"color,omitempty"`
+	Effect     string   `json:"effect,omitempty"`
+	Transition *float64 `json:"transition,omitempty"` // in seconds
+}
+
+type haColor struct {
+	R *int     `json:"r,omitempty"`
+	G *int     `json:"g,omitempty"`
+	B *int     `json:"b,omitempty"`
+	H *float64 `json:"h,omitempty"`
+	S *float64 `json:"s,omitempty"`
+}
+
+// haDiscovery is the Home Assistant discovery config of a light
+type haDiscovery struct {
+	Name                *string          `json:"name"` // null names the light after its device
+	UniqueID            string           `json:"unique_id"`
+	Schema              string           `json:"schema"`
+	StateTopic          string           `json:"state_topic"`
+	CommandTopic        string           `json:"command_topic"`
+	Availability        []haAvailability `json:"availability"`
+	AvailabilityMode    string           `json:"availability_mode"`
+	SupportedColorModes []string         `json:"supported_color_modes"`
+	BrightnessScale     int              `json:"brightness_scale,omitempty"`
+	ColorTempKelvin     bool             `json:"color_temp_kelvin,omitempty"`
+	MinKelvin           int              `json:"min_kelvin,omitempty"`
+	MaxKelvin           int              `json:"max_kelvin,omitempty"`
+	Effect              bool             `json:"effect,omitempty"`
+	EffectList          []string         `json:"effect_list,omitempty"`
+	Device              haDevice         `json:"device"`
+	Origin              haOrigin         `json:"origin"`
+}
+
+type haAvailability struct {
+	Topic string `json:"topic"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+type haOrigin struct {
+	Name      string `json:"name"`
+	SWVersion string `json:"sw_version"`
+}
+
+// run keeps the bridge connected to the broker until the context is cancelled
+func (b *mqttBridge) run(ctx context.Context) error {
+	changes := b.registry.Subscribe(ctx)
+	opts := mqtt.Options{
+		ClientID: mqttClientID,
+		Username: mqttUsername,
+		Password: os.Getenv("YEEGO_MQTT_PASSWORD"),
+		Will:     &mqtt.Message{Topic: mqttPrefix + "/status", Payload: []byte("offline"), Retain: true},
+		Handler: func(m mqtt.Message) {
+			// the commands are run by light, a slow one does not hold the others
+			select {
+			case b.commands <- m:
+			default:
+				fmt.Fprintf(os.Stderr, "Too many commands, dropping the message of %s\n", m.Topic)
+			}
+		},
+	}
+
+	backoff := time.Second
+	for {
+		client, err := mqtt.Dial(ctx, mqttBroker, opts)
+		if err == nil {
+			// the changes missed while disconnected are published with all the lights
+			for len(changes) > 0 {
+				<-changes
+			}
+
+			if err = b.connected(ctx, client); err != nil {
+				client.Close()
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Cannot connect to %s: %v, retrying in %s\n", mqttBroker, err, backoff)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Minute)
+			continue
+		}
+		backoff = time.Second
+		info("Connected to %s\n", mqttBroker)
+
+	connection:
+		for {
+			select {
+			case <-ctx.Done():
+				client.Publish(mqttPrefix+"/status", []byte("offline"), true)
+				client.Close()
+				return nil
+			case <-client.Done():
+				b.setClient(nil)
+				fmt.Fprintf(os.Stderr, "%v, reconnecting\n", client.Err())
+				break connection
+			case status, ok := <-changes:
+				if !ok {
+					return nil
+				}
+				b.publish(status)
+			}
+		}
+	}
+}
+
+// connected subscribes to the commands, and publishes the lights on a new connection
+func (b *mqttBridge) connected(ctx context.Context, client *mqtt.Client) error {
+	if err := client.Publish(mqttPrefix+"/status", []byte("online"), true); err != nil {
+		return err
+	}
+	if err := client.Subscribe(ctx, mqttPrefix+"/+/set", mqttDiscoveryPrefix+"/status"); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.client = client
+	b.announced = make(map[string]bool)
+	b.available = make(map[string]bool)
+	b.mu.Unlock()
+
+	for _, status := range b.registry.Lights() {
+		b.publish(status)
+	}
+
+	return nil
+}
+
+func (b *mqttBridge) setClient(client *mqtt.Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.client = client
+}
+
+// publish announces the light to Home Assistant the first time, then publishes
+// its availability when it changes and its state
+func (b *mqttBridge) publish(status daemon.LightStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client == nil {
+		return
+	}
+
+	id := mqttID(&status.Light)
+	if !b.announced[id] {
+		config, _ := json.Marshal(haConfig(&status.Light))
+		b.client.Publish(mqttDiscoveryPrefix+"/light/yeego_"+id+"/config", config, true)
+		b.announced[id] = true
+	}
+
+	if available, ok := b.available[id]; !ok || available != status.Connected {
+		payload := "offline"
+		if status.Connected {
+			payload = "online"
+		}
+		b.client.Publish(mqttPrefix+"/"+id+"/availability", []byte(payload), true)
+		b.available[id] = status.Connected
+	}
+
+	if !status.Updated.IsZero() {
+		state, _ := json.Marshal(haStateOf(&status.Light))
+		b.client.Publish(mqttPrefix+"/"+id+"/state", state, true)
+	}
+}
+
+// execute runs the commands received from the broker, in order for each light,
+// so that a slow light does not hold the commands of the others
+func (b *mqttBridge) execute(ctx context.Context) {
+	workers := make(map[string]chan []byte)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-b.commands:
+			if m.Topic == mqttDiscoveryPrefix+"/status" {
+				// Home Assistant restarted and forgot the lights
+				if string(m.Payload) == "online" {
+					b.reannounce()
+				}
+				continue
+			}
+
+			id := strings.TrimSuffix(strings.TrimPrefix(m.Topic, mqttPrefix+"/"), "/set")
+			if b.light(id) == nil {
+				fmt.Fprintf(os.Stderr, "Cannot run the command of %s: light %s not found\n", m.Topic, id)
+				continue
+			}
+
+			work, ok := workers[id]
+			if !ok {
+				work = make(chan []byte, 8)
+				workers[id] = work
+				go b.work(ctx, id, work)
+			}
+
+			select {
+			case work <- m.Payload:
+			default:
+				fmt.Fprintf(os.Stderr, "Too many commands, dropping the message of %s\n", m.Topic)
+			}
+		}
+	}
+}
+
+// work runs the commands of a light until the context is cancelled
+func (b *mqttBridge) work(ctx context.Context, id string, payloads <-chan []byte) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-payloads:
+			if err := b.command(id, payload); err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot run the command of %s/%s/set: %v\n", mqttPrefix, id, err)
+			}
+		}
+	}
+}
+
+func (b *mqttBridge) reannounce() {
+	b.mu.Lock()
+	b.announced = make(map[string]bool)
+	b.available = make(map[string]bool)
+	b.mu.Unlock()
+
+	for _, status := range b.registry.Lights() {
+		b.publish(status)
+	}
+}
+
+// command runs a command in the Home Assistant JSON light schema on the light
+func (b *mqttBridge) command(id string, payload []byte) error {
+	light := b.light(id)
+	if light == nil {
+		return fmt.Errorf("Light %s not found", id)
+	}
+
+	var req haState
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return fmt.Errorf("Invalid command: %w", err)
+	}
+
+	flow, ok := flowPresets[req.Effect]
+	if req.Effect != "" && !ok {
+		return fmt.Errorf("Unknown effect %q", req.Effect)
+	}
+
+	var duration int
+	if req.Transition != nil {
+		duration = int(*req.Transition * 1000)
+	}
+
+	switch req.State {
+	case "OFF":
+		_, err := light.SetPower("off", duration)
+		return err
+	case "ON":
+		if _, err := light.SetPower("on", duration); err != nil {
+			return err
+		}
+	case "":
+	default:
+		return fmt.Errorf("Invalid state %q, must be ON or OFF", req.State)
+	}
+
+	if req.ColorTemp != nil {
+		if _, err := light.SetCtAbx(*req.ColorTemp, duration); err != nil {
+			return err
+		}
+	}
+
+	if c := req.Color; c != nil {
+		var err error
+		switch {
+		case c.R != nil && c.G != nil && c.B != nil:
+			_, err = light.SetRGB(*c.R, *c.G, *c.B, duration)
+		case c.H != nil && c.S != nil:
+			_, err = light.SetHSV(int(*c.H), int(*c.S), duration)
+		default:
+			err = fmt.Errorf("Invalid color, must have r, g and b, or h and s")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if req.Brightness != nil {
+		if _, err := light.SetBright(max(*req.Brightness, 1), duration); err != nil {
+			return err
+		}
+	}
+
+	// the effect is started last, a command changing the light would stop it;
+	// the state set above is recovered when it is stopped
+	if req.Effect != "" {
+		if _, err := light.StartCf(0, 0, flow); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// light returns the light of the registry identified by id in the topics, nil if unknown
+func (b *mqttBridge) light(id string) *yeelight.Yeelight {
+	for _, status := range b.registry.Lights() {
+		if mqttID(&status.Light) == id {
+			return b.registry.Light(status.Light.Location)
+		}
+	}
+
+	return nil
+}
+
+// mqttID identifies a light in the topics: its ID, or its address
+func mqttID(light *yeelight.Yeelight) string {
+	if light.ID != "" {
+		return light.ID
+	}
+
+	return strings.NewReplacer(".", "_", ":", "_").Replace(light.Location)
+}
+
+// haColorModes returns the Home Assistant color modes of the light
+func haColorModes(light *yeelight.Yeelight) []string {
+	var modes []string
+	if light.Supports("set_rgb") {
+		modes = append(modes, "rgb")
+	} else if light.Supports("set_hsv") {
+		modes = append(modes, "hs")
+	}
+	if light.Supports("set_ct_abx") {
+		modes = append(modes, "color_temp")
+	}
+
+	switch {
+	case len(modes) > 0:
+		return modes
+	case light.Supports("set_bright"):
+		return []string{"brightness"}
+	default:
+		return []string{"onoff"}
+	}
+}
+
+// haConfig returns the discovery config of the light, from its Model and Support
+func haConfig(light *yeelight.Yeelight) haDiscovery {
+	id := mqttID(light)
+	modes := haColorModes(light)
+
+	config := haDiscovery{
+		UniqueID:     "yeego_" + id,
+		Schema:       "json",
+		StateTopic:   mqttPrefix + "/" + id + "/state",
+		CommandTopic: mqttPrefix + "/" + id + "/set",
+		Availability: []haAvailability{
+			{Topic: mqttPrefix + "/status"},
+			{Topic: mqttPrefix + "/" + id + "/availability"},
+		},
+		AvailabilityMode:    "all",
+		SupportedColorModes: modes,
+		Device: haDevice{
+			Identifiers:  []string{"yeego_" + id},
+			Name:         lightLabel(light),
+			Manufacturer: "Yeelight",
+			Model:        light.Model,
+		},
+		Origin: haOrigin{Name: "yeego", SWVersion: version},
+	}
+	if light.FWVersion != 0 {
+		config.Device.SWVersion = fmt.Sprint(light.FWVersion)
+	}
+
+	if modes[0] != "onoff" {
+		config.BrightnessScale = 100
+	}
+	if contains(modes, "color_temp") {
+		config.ColorTempKelvin = true
+		config.MinKelvin, config.MaxKelvin = 2700, 6500
+		if contains(modes, "rgb") || contains(modes, "hs") {
+			config.MinKelvin = 1700
+		}
+	}
+	if light.Supports("start_cf") {
+		config.Effect = true
+		config.EffectList = sortedKeys(flowPresets)
+	}
+
+	return config
+}
+
+// haStateOf returns the state of the light in the Home Assistant JSON light schema
+func haStateOf(light *yeelight.Yeelight) haState {
+	state := haState{State: strings.ToUpper(light.Power)}
+	if state.State != "ON" {
+		state.State = "OFF"
+	}
+
+	modes := haColorModes(light)
+	if modes[0] == "onoff" {
+		return state
+	}
+
+	bright := light.Bright
+	state.Brightness = &bright
+
+	mode := map[int]string{1: "rgb", 2: "color_temp", 3: "hs"}[light.ColorMode]
+	if !contains(modes, mode) {
+		mode = modes[0]
+	}
+	state.ColorMode = mode
+
+	switch mode {
+	case "rgb":
+		r, g, bl := light.RGB>>16&0xff, light.RGB>>8&0xff, light.RGB&0xff
+		state.Color = &haColor{R: &r, G: &g, B: &bl}
+	case "hs":
+		h, s := float64(light.Hue), float64(light.Saturation)
+		state.Color = &haColor{H: &h, S: &s}
+	case "color_temp":
+		ct := light.ColorTemp
+		state.ColorTemp = &ct
+	}
+
+	return state
+}
+
+func init() {
+	hostname, _ := os.Hostname()
+
+	mqttCmd.Flags().StringVar(&mqttBroker, "broker", "tcp://localhost:1883", "URL of the MQTT broker, tcp:// or tls://")
+	mqttCmd.Flags().StringVar(&mqttUsername, "username", "", "User of the broker, the password is read from YEEGO_MQTT_PASSWORD")
+	mqttCmd.Flags().StringVar(&mqttClientID, "client-id", "yeego-"+hostname, "Client identifier given to the broker")
+	mqttCmd.Flags().StringVar(&mqttPrefix, "prefix", "yeego", "Prefix of the topics of the lights")
+	mqttCmd.Flags().StringVar(&mqttDiscoveryPrefix, "discovery-prefix", "homeassistant", "Prefix of the Home Assistant discovery topics")
+	rootCmd.AddCommand(mqttCmd)
+}
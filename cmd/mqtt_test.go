@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienrbrt/yeego/internal/daemon"
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+// recordingClient returns a client recording the commands instead of sending them
+func recordingClient() (*yeelight.Client, func() []string) {
+	var mu sync.Mutex
+	var sent []string
+
+	client := yeelight.NewClient(yeelight.WithMiddleware(func(next yeelight.Handler) yeelight.Handler {
+		return func(ctx context.Context, ex *yeelight.Exchange) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			sent = append(sent, fmt.Sprint(ex.Command.Method, ex.Command.Params))
+			ex.Response = yeelight.Response{ID: ex.Command.ID, Result: []interface{}{"ok"}}
+			return nil
+		}
+	}))
+
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), sent...)
+	}
+}
+
+// recordingBridge is a bridge whose light records the commands
+func recordingBridge() (*mqttBridge, func() []string) {
+	client, sent := recordingClient()
+	lights := []yeelight.Yeelight{{ID: "0x01", Location: "10.0.0.1:55443", Model: "color"}}
+
+	return &mqttBridge{registry: daemon.NewRegistry(client, lights, time.Minute)}, sent
+}
+
+func TestMQTTCommand(t *testing.T) {
+	for _, test := range []struct {
+		payload string
+		want    []string
+	}{
+		{`{"state": "OFF", "brightness": 40}`, []string{"set_power[off sudden 0]"}},
+		{`{"state": "ON", "brightness": 40, "transition": 0.5}`, []string{"set_power[on smooth 500]", "set_bright[40 smooth 500]"}},
+		{`{"color_temp": 2700, "brightness": 0}`, []string{"set_ct_abx[2700 sudden 0]", "set_bright[1 sudden 0]"}},
+		{`{"color": {"r": 255, "g": 0, "b": 0}}`, []string{"set_rgb[16711680 sudden 0]"}},
+		{`{"color": {"h": 240, "s": 100}}`, []string{"set_hsv[240 100 sudden 0]"}},
+		// the effect is started once the rest is set, which would stop it
+		{`{"state": "ON", "effect": "police", "brightness": 60, "color": {"r": 0, "g": 0, "b": 255}}`, []string{
+			"set_power[on sudden 0]", "set_rgb[255 sudden 0]", "set_bright[60 sudden 0]",
+			"start_cf[0 0 " + flowPresets["police"] + "]",
+		}},
+	} {
+		b, sent := recordingBridge()
+		if err := b.command("0x01", []byte(test.payload)); err != nil {
+			t.Errorf("%s: %v", test.payload, err)
+			continue
+		}
+		if got := sent(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.payload, got, test.want)
+		}
+	}
+}
+
+func TestMQTTCommandInvalid(t *testing.T) {
+	for _, payload := range []string{
+		`{"state": "DIM"}`,
+		`{"state": "ON", "effect": "unknown"}`,
+		`{"color": {"r": 255}}`,
+		`not json`,
+	} {
+		b, sent := recordingBridge()
+		if err := b.command("0x01", []byte(payload)); err == nil {
+			t.Errorf("%s: no error", payload)
+		}
+		if len(sent()) > 0 {
+			t.Errorf("%s: got %v sent", payload, sent())
+		}
+	}
+
+	b, _ := recordingBridge()
+	if err := b.command("0x02", []byte(`{"state": "ON"}`)); err == nil {
+		t.Error("command of an unknown light accepted")
+	}
+}
@@ -0,0 +1,414 @@
+package cmd
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+// route is an endpoint of the HTTP API, described in its OpenAPI document
+type route struct {
+	method   string
+	pattern  string // segments in braces are parameters, such as /lights/{light}
+	summary  string
+	body     interface{} // example of the request body, nil without body
+	response interface{} // example of the response body
+	handle   func(w http.ResponseWriter, r *http.Request, params map[string]string) error
+}
+
+// match returns the parameters of the path if it matches the pattern
+func (rt route) match(path string) (map[string]string, bool) {
+	want := strings.Split(strings.Trim(rt.pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range want {
+		if strings.HasPrefix(segment, "{") {
+			params[strings.Trim(segment, "{}")] = got[i]
+		} else if segment != got[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// routes returns the endpoints of the API, the lights and the groups have the same ones
+func (a *httpAPI) routes() []route {
+	routes := []route{
+		{
+			method: http.MethodGet, pattern: "/lights", summary: "List the lights",
+			response: []lightResource{},
+			handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				resources := make([]lightResource, len(lights))
+				for i := range lights {
+					resources[i] = a.resource(&lights[i])
+				}
+				return writeJSON(w, http.StatusOK, resources)
+			},
+		},
+		{
+			method: http.MethodGet, pattern: "/lights/{light}", summary: "Get a light by name, alias or IP",
+			response: lightResource{},
+			handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				matched, err := a.lightsOf("light", params["light"])
+				if err != nil {
+					return err
+				}
+				return writeJSON(w, http.StatusOK, a.resource(matched[0]))
+			},
+		},
+		{
+			method: http.MethodGet, pattern: "/groups", summary: "List the groups",
+			response: []groupResource{},
+			handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				resources := make([]groupResource, 0, len(groups))
+				for _, name := range sortedKeys(groups) {
+					g, err := a.group(name)
+					if err != nil {
+						return err
+					}
+					resources = append(resources, g)
+				}
+				return writeJSON(w, http.StatusOK, resources)
+			},
+		},
+		{
+			method: http.MethodGet, pattern: "/groups/{group}", summary: "Get a group",
+			response: groupResource{},
+			handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				g, err := a.group(params["group"])
+				if err != nil {
+					return err
+				}
+				return writeJSON(w, http.StatusOK, g)
+			},
+		},
+	}
+
+	for _, kind := range []string{"light", "group"} {
+		kind := kind
+		base := "/" + kind + "s/{" + kind + "}"
+		routes = append(routes,
+			route{
+				method: http.MethodPut, pattern: base + "/state", summary: "Set the state of the " + kind + ", the power is mandatory",
+				body: stateRequest{}, response: []result{},
+				handle: a.stateHandler(kind, true),
+			},
+			route{
+				method: http.MethodPatch, pattern: base + "/state", summary: "Change some properties of the " + kind,
+				body: stateRequest{}, response: []result{},
+				handle: a.stateHandler(kind, false),
+			},
+			route{
+				method: http.MethodPost, pattern: base + "/toggle", summary: "Toggle the " + kind,
+				response: []result{},
+				handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+					matched, err := a.lightsOf(kind, params[kind])
+					if err != nil {
+						return err
+					}
+					return a.run(w, matched, "toggle", func(light *yeelight.Yeelight) error {
+						_, err := light.Toggle()
+						return err
+					})
+				},
+			},
+			route{
+				method: http.MethodPost, pattern: base + "/flow", summary: "Start a color flow on the " + kind,
+				body: flowRequest{}, response: []result{},
+				handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+					var req flowRequest
+					if err := decodeBody(r, &req); err != nil {
+						return err
+					}
+					action, err := flowAction(req.Action)
+					if err != nil {
+						return err
+					}
+					expression, ok := flowPresets[req.Flow]
+					if !ok {
+						expression = req.Flow
+					}
+					flow, err := yeelight.ParseFlow(expression)
+					if err != nil {
+						return badRequest("%w", err)
+					}
+
+					matched, err := a.lightsOf(kind, params[kind])
+					if err != nil {
+						return err
+					}
+					return a.run(w, matched, "flow", func(light *yeelight.Yeelight) error {
+						_, err := light.StartCf(req.Count, action, flow.String())
+						return err
+					})
+				},
+			},
+			route{
+				method: http.MethodPost, pattern: base + "/adjust", summary: "Adjust the brightness, color temperature or color of the " + kind,
+				body: adjustRequest{}, response: []result{},
+				handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+					var req adjustRequest
+					if err := decodeBody(r, &req); err != nil {
+						return err
+					}
+					if !contains([]string{"increase", "decrease", "circle"}, req.Action) {
+						return badRequest("Invalid action %q, must be increase, decrease or circle", req.Action)
+					}
+					if !contains([]string{"bright", "ct", "color"}, req.Property) {
+						return badRequest("Invalid property %q, must be bright, ct or color", req.Property)
+					}
+
+					matched, err := a.lightsOf(kind, params[kind])
+					if err != nil {
+						return err
+					}
+					return a.run(w, matched, "adjust", func(light *yeelight.Yeelight) error {
+						_, err := light.SetAdjust(req.Action, req.Property)
+						return err
+					})
+				},
+			},
+		)
+	}
+
+	return append(routes,
+		route{
+			method: http.MethodGet, pattern: "/scenes", summary: "List the scenes",
+			response: []sceneEntry{},
+			handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				entries := make([]sceneEntry, 0, len(scenes))
+				for _, name := range sortedKeys(scenes) {
+					entries = append(entries, sceneEntry{Name: name, scene: scenes[name]})
+				}
+				return writeJSON(w, http.StatusOK, entries)
+			},
+		},
+		route{
+			method: http.MethodGet, pattern: "/scenes/{scene}", summary: "Get a scene",
+			response: sceneEntry{},
+			handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				s, ok := scenes[params["scene"]]
+				if !ok {
+					return notFound("Scene %s not found", params["scene"])
+				}
+				return writeJSON(w, http.StatusOK, sceneEntry{Name: params["scene"], scene: s})
+			},
+		},
+		route{
+			method: http.MethodPost, pattern: "/scenes/{scene}/apply", summary: "Apply a scene to lights, the target is read as by the CLI",
+			body: applyRequest{}, response: []result{},
+			handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				s, ok := scenes[params["scene"]]
+				if !ok {
+					return notFound("Scene %s not found", params["scene"])
+				}
+
+				var req applyRequest
+				if err := decodeBody(r, &req); err != nil {
+					return err
+				}
+				matched, err := resolveTargets(req.Target)
+				if err != nil {
+					return notFound("%w", err)
+				}
+				for i, light := range matched {
+					matched[i] = a.registry.Light(light.Location)
+				}
+
+				return a.run(w, matched, "scene "+params["scene"], func(light *yeelight.Yeelight) error {
+					return s.apply(r.Context(), light)
+				})
+			},
+		},
+		route{
+			method: http.MethodGet, pattern: "/events", summary: "Stream the state of the lights as Server-Sent Events named state",
+			response: lightResource{},
+			handle: func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				return a.events(w, r)
+			},
+		},
+	)
+}
+
+// stateHandler changes the state of a light or of the lights of a group
+func (a *httpAPI) stateHandler(kind string, full bool) func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		var req stateRequest
+		if err := decodeBody(r, &req); err != nil {
+			return err
+		}
+		if err := req.validate(full); err != nil {
+			return err
+		}
+
+		matched, err := a.lightsOf(kind, params[kind])
+		if err != nil {
+			return err
+		}
+
+		return a.run(w, matched, "state", func(light *yeelight.Yeelight) error {
+			return setState(light, req)
+		})
+	}
+}
+
+// openAPI generates the OpenAPI document of the routes, the schemas are built
+// from the types of their bodies
+func openAPI(routes []route) map[string]interface{} {
+	paths := make(map[string]map[string]interface{})
+	for _, rt := range routes {
+		operation := map[string]interface{}{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Success",
+					"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(rt.response))}},
+				},
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(apiError{}))}},
+				},
+			},
+		}
+
+		var parameters []interface{}
+		for _, segment := range strings.Split(rt.pattern, "/") {
+			if strings.HasPrefix(segment, "{") {
+				parameters = append(parameters, map[string]interface{}{
+					"name": strings.Trim(segment, "{}"), "in": "path", "required": true,
+					"schema": map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+
+		if rt.body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(rt.body))}},
+			}
+		}
+
+		if rt.pattern == "/events" {
+			operation["responses"].(map[string]interface{})["200"] = map[string]interface{}{
+				"description": "Stream of events named state, their data is a light",
+				"content":     map[string]interface{}{"text/event-stream": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(rt.response))}},
+			}
+		}
+
+		if paths[rt.pattern] == nil {
+			paths[rt.pattern] = make(map[string]interface{})
+		}
+		paths[rt.pattern][strings.ToLower(rt.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "yeego",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}},
+	}
+}
+
+// operationID names an operation from its method and path, with its path parameters
+// at the end, such as getLights for /lights and patchLightsStateByLight for /lights/{light}/state
+func operationID(rt route) string {
+	id := strings.ToLower(rt.method)
+	var params []string
+	for _, segment := range strings.Split(rt.pattern, "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, "{") {
+			segment = strings.Trim(segment, "{}")
+			params = append(params, strings.ToUpper(segment[:1])+segment[1:])
+			continue
+		}
+		id += strings.ToUpper(segment[:1]) + segment[1:]
+	}
+
+	if len(params) > 0 {
+		id += "By" + strings.Join(params, "And")
+	}
+
+	return id
+}
+
+// schemaOf returns the JSON schema of the JSON encoding of a type
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(duration(0)):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		addProperties(t, properties)
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// addProperties adds the fields of a struct, and of its embedded structs, as encoding/json does
+func addProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addProperties(field.Type, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaOf(field.Type)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = schema
+	}
+}
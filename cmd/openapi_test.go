@@ -0,0 +1,18 @@
+package cmd
+
+import "testing"
+
+func TestOperationIDUnique(t *testing.T) {
+	seen := make(map[string]string)
+	for _, rt := range (&httpAPI{}).routes() {
+		id := operationID(rt)
+		if previous, ok := seen[id]; ok {
+			t.Errorf("%s %s and %s have the same operation ID %s", rt.method, rt.pattern, previous, id)
+		}
+		seen[id] = rt.method + " " + rt.pattern
+	}
+
+	if id := operationID(route{method: "POST", pattern: "/scenes/{scene}/apply"}); id != "postScenesApplyByScene" {
+		t.Fatalf("got %s, want postScenesApplyByScene", id)
+	}
+}
@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// outputFormat is how the results are printed: text, json, yaml, table or template
+	outputFormat string
+
+	// outputTemplate is the Go template executed for each result with --output template
+	outputTemplate string
+
+	// tmpl is the parsed outputTemplate
+	tmpl *template.Template
+
+	// rendered is set once the results are printed in a structured format, with their errors
+	rendered bool
+)
+
+// result is what a command did on a light, printed by the structured output formats
+type result struct {
+	ID       string             `json:"id,omitempty"`
+	Name     string             `json:"name,omitempty"`
+	Address  string             `json:"address"`
+	Room     string             `json:"room,omitempty"`
+	Tags     []string           `json:"tags,omitempty"`
+	Action   string             `json:"action"`
+	Success  bool               `json:"success"`
+	Error    string             `json:"error,omitempty"`
+	Response *yeelight.Response `json:"response,omitempty"`
+	State    *yeelight.Yeelight `json:"state,omitempty"`
+}
+
+// newResult returns the result of an action on a light
+func newResult(light *yeelight.Yeelight, action string, err error) result {
+	r := result{
+		ID:      light.ID,
+		Name:    light.Name,
+		Address: strings.Split(light.Location, ":")[0],
+		Action:  action,
+		Success: err == nil,
+	}
+
+	if m, ok := meta[lightLabel(light)]; ok {
+		r.Room, r.Tags = m.Room, m.Tags
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+// withState adds the state of the light to the result
+func (r result) withState(light *yeelight.Yeelight) result {
+	state := *light
+	r.State = &state
+	if r.Name == "" {
+		r.ID, r.Name = light.ID, light.Name
+	}
+
+	return r
+}
+
+// checkOutput validates the output flags before running a command
+func checkOutput() error {
+	switch outputFormat {
+	case "text", "json", "yaml", "table":
+	case "template":
+		if outputTemplate == "" {
+			return errors.New("Please enter the template with --template")
+		}
+
+		var err error
+		if tmpl, err = template.New("output").Parse(outputTemplate); err != nil {
+			return fmt.Errorf("Invalid template: %w", err)
+		}
+	default:
+		return fmt.Errorf("Invalid output %q, must be text, json, yaml, table or template", outputFormat)
+	}
+
+	return nil
+}
+
+// structured is true when the output is read by programs rather than people
+func structured() bool {
+	return outputFormat != "text"
+}
+
+// info prints a message which is not a result, kept out of stdout by the structured formats
+func info(format string, a ...interface{}) {
+	if structured() {
+		fmt.Fprintf(os.Stderr, format, a...)
+		return
+	}
+
+	fmt.Printf(format, a...)
+}
+
+// render prints v in the output format, text and table print v as the command wants
+// v is a slice of results or entries, the template is executed for each of them
+func render(v interface{}, text func(), table func(w io.Writer)) error {
+	rendered = structured()
+
+	switch outputFormat {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "yaml":
+		return writeYAML(os.Stdout, v)
+	case "template":
+		items := reflect.ValueOf(v)
+		if items.Kind() != reflect.Slice {
+			return executeTemplate(v)
+		}
+
+		for i := 0; i < items.Len(); i++ {
+			if err := executeTemplate(items.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "table":
+		if table == nil {
+			return fmt.Errorf("Output table is not supported by %s", currentAction)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	default:
+		text()
+		return nil
+	}
+}
+
+func executeTemplate(v interface{}) error {
+	if err := tmpl.Execute(os.Stdout, v); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	return nil
+}
+
+// writeYAML writes v with the names of its JSON encoding, in the same order
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// JSON is YAML, only its flow style and quotes need to be removed
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	resetStyle(&node)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+func resetStyle(node *yaml.Node) {
+	// keep the quotes of the strings read as booleans by YAML 1.1, such as the power "on"
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!str" || !oldBool(node.Value) {
+		node.Style = 0
+	}
+
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+func oldBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "y", "yes", "n", "no", "on", "off":
+		return true
+	}
+
+	return false
+}
+
+// printError prints the error ending a command, as a failed result in the structured formats
+// unless it is already in the results printed
+func printError(err error) {
+	if structured() && checkOutput() == nil {
+		if rendered {
+			return
+		}
+
+		failed := result{Action: currentAction, Error: err.Error()}
+		if printResults([]result{failed}, nil) == nil {
+			return
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "Error:", err)
+}
+
+// printResults prints the results of a command, text prints them as sentences
+func printResults(results []result, text func()) error {
+	return render(results, text, func(w io.Writer) {
+		fmt.Fprintln(w, "LIGHT\tADDRESS\tACTION\tRESULT")
+		for _, r := range results {
+			status := "ok"
+			if !r.Success {
+				status = r.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, r.Address, r.Action, status)
+		}
+	})
+}
+
+// stateTable prints the state of the lights of the results
+func stateTable(results []result) func(w io.Writer) {
+	return func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tADDRESS\tMODEL\tPOWER\tBRIGHT\tMODE\tCT\tRGB\tROOM\tTAGS")
+		for _, r := range results {
+			if r.State == nil {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Address, r.Error)
+				continue
+			}
+
+			s := r.State
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Name, r.Address, s.Model, s.Power, number(s.Bright), colorMode(s.ColorMode),
+				number(s.ColorTemp), hexColor(s.RGB), r.Room, strings.Join(r.Tags, ","))
+		}
+	}
+}
+
+func number(v int) string {
+	if v == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(v)
+}
+
+func hexColor(rgb int) string {
+	if rgb == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("#%06x", rgb)
+}
+
+func colorMode(mode int) string {
+	switch mode {
+	case 1:
+		return "color"
+	case 2:
+		return "ct"
+	case 3:
+		return "hsv"
+	default:
+		return ""
+	}
+}
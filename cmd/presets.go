@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// namedColors can be given instead of a color in hexadecimal
+var namedColors = map[string]int{
+	"red":     0xff0000,
+	"orange":  0xff8000,
+	"yellow":  0xffff00,
+	"green":   0x00ff00,
+	"cyan":    0x00ffff,
+	"blue":    0x0000ff,
+	"purple":  0x8000ff,
+	"magenta": 0xff00ff,
+	"pink":    0xff69b4,
+	"white":   0xffffff,
+}
+
+// flowPresets can be given to start-cf and to the scenes instead of a flow expression,
+// the durations are in milliseconds as sent to the lights
+var flowPresets = map[string]string{
+	"candle":  "800,2,1900,50,600,2,1900,30,1000,2,1900,60,500,2,1900,40",
+	"pulse":   "1000,2,4000,100,1000,2,4000,1",
+	"police":  "300,1,16711680,100,300,1,255,100",
+	"disco":   "500,1,16711680,100,500,1,65280,100,500,1,255,100",
+	"sunrise": "50,1,16731392,1,360000,2,1700,10,540000,2,2700,100",
+}
+
+// parseColor parses a named color or a color in hexadecimal, with or without "#"
+func parseColor(s string) (int, error) {
+	if rgb, ok := namedColors[strings.ToLower(s)]; ok {
+		return rgb, nil
+	}
+
+	rgb, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 24)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid color %q, must be hexadecimal as #ff8800 or one of %s", s, strings.Join(sortedKeys(namedColors), ", "))
+	}
+
+	return int(rgb), nil
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var rawCmd = &cobra.Command{
+	Use:   "raw [name/IP] [method] [params...]",
+	Short: "Send any method to a given light",
+	Long: `Send any method to a given light and print the full response.
+Use it for the methods not wrapped by yeego (dev_toggle, adjust_bright, bg_set_rgb...).
+Each parameter is read as a JSON literal, values which are not valid JSON are sent as strings.`,
+	Example: `yeego raw bedroom dev_toggle
+yeego raw bedroom adjust_bright 20 500
+yeego raw bedroom bg_set_rgb 16711680 smooth 500`,
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeArgs(completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		matched, err := resolveTargets(args[0])
+		if err != nil {
+			return err
+		}
+
+		params := make([]interface{}, 0, len(args)-2)
+		for _, arg := range args[2:] {
+			var param interface{}
+			if err := json.Unmarshal([]byte(arg), &param); err != nil {
+				param = arg
+			}
+			params = append(params, param)
+		}
+
+		results := make([]result, len(matched))
+		errs := runOnLights(matched, func(i int, light *yeelight.Yeelight) error {
+			resp, err := light.Call(context.Background(), args[1], params...)
+			results[i] = newResult(light, currentAction, err)
+			if resp.ID != 0 {
+				results[i].Response = &resp
+			}
+			return err
+		})
+
+		err = printResults(results, func() {
+			for i, light := range matched {
+				if results[i].Response != nil {
+					respJSON, _ := json.Marshal(results[i].Response)
+					if len(matched) == 1 {
+						fmt.Printf("%s\n", respJSON)
+					} else {
+						fmt.Printf("%s: %s\n", lightLabel(light), respJSON)
+					}
+				} else if errs[i] != nil && len(matched) > 1 {
+					fmt.Printf("%s: %v\n", lightLabel(light), errs[i])
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(matched) == 1 {
+			return errs[0]
+		}
+
+		return failedLights(errs)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rawCmd)
+}
@@ -1,19 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
 	"os"
-	"path"
 	"strings"
 	"time"
 
+	"github.com/julienrbrt/yeego/internal/daemon"
 	"github.com/julienrbrt/yeego/light/yeelight"
-	"github.com/kardianos/osext"
 	"github.com/spf13/cobra"
 )
 
@@ -25,13 +23,87 @@ var (
 	errNotFoundLight    = errors.New("Light not found")
 	errYeelightNotFound = errors.New("No Yeelight found. Run `yeego discover` to find lights on your network")
 
-	// configuration file name
-	confName = ".yeego"
+	// verbose prints the JSON exchanged with the lights
+	verbose bool
 
-	// timeout used for discover and effects
-	timeout time.Duration
+	// fallback translates colors for the lights which cannot render them
+	fallback bool
+
+	// currentAction is the command being run, as reported in the results
+	currentAction string
+
+	// stateRefreshed is set by the commands which got the properties of the lights
+	stateRefreshed bool
+
+	// deferFor keeps the commands of unreachable lights until they come back
+	deferFor time.Duration
+
+	// retry is how failed requests are retried, it can be changed in the configuration file
+	retry = retryConfig{
+		MaxAttempts: yeelight.DefaultRetryPolicy.MaxAttempts,
+		BaseDelay:   duration(yeelight.DefaultRetryPolicy.BaseDelay),
+		MaxDelay:    duration(yeelight.DefaultRetryPolicy.MaxDelay),
+		Jitter:      yeelight.DefaultRetryPolicy.Jitter,
+	}
+
+	// layout is the position of the lights in the room, by name or IP
+	layout = make(map[string]yeelight.Point)
 )
 
+// retryConfig is the retry policy as written in the configuration file
+type retryConfig struct {
+	MaxAttempts int      `json:"max_attempts"`
+	BaseDelay   duration `json:"base_delay"`
+	MaxDelay    duration `json:"max_delay"`
+	Jitter      float64  `json:"jitter"`
+}
+
+func (r retryConfig) policy() yeelight.RetryPolicy {
+	return yeelight.RetryPolicy{
+		MaxAttempts: r.MaxAttempts,
+		BaseDelay:   time.Duration(r.BaseDelay),
+		MaxDelay:    time.Duration(r.MaxDelay),
+		Jitter:      r.Jitter,
+	}
+}
+
+// duration is a time.Duration written as a string ("200ms") in the configuration file
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = duration(v)
+	return nil
+}
+
+// configOnly annotates the commands which do not talk to the lights, the lights
+// are not read and saved after them
+var configOnly = map[string]string{"configOnly": "true"}
+
+// isConfigOnly reports whether the command or one of its parents is configOnly
+func isConfigOnly(cmd *cobra.Command) bool {
+	for ; cmd != nil; cmd = cmd.Parent() {
+		if cmd.Annotations["configOnly"] == "true" {
+			return true
+		}
+	}
+
+	return false
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "yeego",
@@ -40,27 +112,76 @@ var rootCmd = &cobra.Command{
 your Yeelight bulbs in your LAN directly from your terminal.`,
 	Example: `yeego discover
 yeego on bedroom`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		currentAction = strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+		if err := checkOutput(); err != nil {
+			return err
+		}
+
+		if err := loadConfig(); err != nil {
+			return err
+		}
+		applyDefaults(cmd.Flags().Changed)
+
+		if verbose {
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			yeelight.Use(yeelight.WireLogger(logger))
+		}
+
+		if fallback {
+			yeelight.Use(yeelight.Fallback())
+		}
+
+		if deferFor > 0 {
+			outbox := yeelight.NewOutbox(yeelight.DefaultClient, 5*time.Second)
+			yeelight.Use(outbox.Middleware(deferFor))
+			go outbox.Run(context.Background())
+		}
+
+		// the daemon retries the requests itself, its middleware is the last one
+		useDaemon(cmd)
+		if !viaDaemon {
+			yeelight.SetRetryPolicy(retry.policy())
+		}
+
+		return nil
+	},
 	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) == 0 {
+		if len(args) == 0 || isConfigOnly(cmd) {
 			// if no light do not write anything
 			return nil
 		}
 
-		light, err := argToYeelight(args[0])
-		if err != nil {
-			// if error do not write anything
+		// the daemon saves the state of the lights
+		if viaDaemon {
 			return nil
 		}
 
-		// Get light properties
-		err = light.GetProp()
+		matched, err := resolveTargets(args[0])
 		if err != nil {
+			// if error do not write anything
 			return nil
 		}
 
-		for i := range lights {
-			if lights[i].Location == light.Location {
-				lights[i] = *light
+		// the command already got the properties of the lights
+		if stateRefreshed {
+			return writeConfig(&lights)
+		}
+
+		// Get lights properties
+		errs := runOnLights(matched, func(_ int, light *yeelight.Yeelight) error {
+			return light.GetProp()
+		})
+
+		for i, light := range matched {
+			if errs[i] != nil {
+				continue
+			}
+
+			for j := range lights {
+				if lights[j].Location == light.Location {
+					lights[j] = *light
+				}
 			}
 		}
 
@@ -71,65 +192,46 @@ yeego on bedroom`,
 
 // argToYeelight searches a yeelight in the preloaded lights or build a new light if an IP is provided
 func argToYeelight(addr string) (*yeelight.Yeelight, error) {
-	for _, light := range lights {
+	if target, ok := aliases[strings.ToLower(addr)]; ok {
+		addr = target
+	}
+
+	for i, light := range lights {
 		if light.Name == strings.ToLower(addr) || strings.Split(light.Location, ":")[0] == addr {
-			return &light, nil
+			return &lights[i], nil
 		}
 	}
 
 	// parse the value as IP, permits to verify if the user enters an IP
 	ip := net.ParseIP(addr)
 	if ip != nil {
-		return &yeelight.Yeelight{Location: addr + ":" + yeelight.Port}, nil
+		return yeelight.DefaultClient.Light(addr), nil
 	}
 
 	return &yeelight.Yeelight{}, errYeelightNotFound
 }
 
-// Write the yeego config file
-func writeConfig(lights *[]yeelight.Yeelight) error {
-	// no light found, do not write any config file
-	if len(*lights) == 0 {
-		return nil
-	}
-
-	lightsJSON, err := json.Marshal(lights)
-	if err != nil {
-		return err
-	}
-
-	//get program path
-	folderPath, err := osext.ExecutableFolder()
-	if err != nil {
-		return err
-	}
-
-	// write config file
-	err = ioutil.WriteFile(path.Join(folderPath, confName), lightsJSON, 0644)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// the error is printed once, in the output format
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		printError(err)
 		os.Exit(1)
 	}
 }
 
 func init() {
-	//get program path
-	folderPath, err := osext.ExecutableFolder()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// read configuration file - no error check
-	file, _ := ioutil.ReadFile(path.Join(folderPath, confName))
-	json.Unmarshal(file, &lights)
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Configuration file (default $XDG_CONFIG_HOME/yeego/config.json)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "Output format: text, json, yaml, table or template")
+	rootCmd.RegisterFlagCompletionFunc("output", completeFlag(completeValues("text", "json", "yaml", "table", "template")))
+	rootCmd.PersistentFlags().StringVar(&outputTemplate, "template", "", "Go template executed for each result with --output template")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print the JSON exchanged with the lights")
+	rootCmd.PersistentFlags().BoolVar(&fallback, "fallback", false, "Translate colors to color temperature or brightness for the lights without colors")
+	rootCmd.PersistentFlags().DurationVar(&deferFor, "defer", 0, "Wait up to this duration for unreachable lights to come back")
+	rootCmd.PersistentFlags().StringVar(&socketPath, "socket", daemon.SocketPath(), "Unix socket of the daemon")
+	rootCmd.PersistentFlags().BoolVar(&direct, "direct", false, "Send the commands to the lights directly, even when the daemon is running")
 }
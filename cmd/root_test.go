@@ -0,0 +1,24 @@
+package cmd
+
+import "testing"
+
+func TestConfigOnly(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"group subcommand", []string{"group", "add", "upstairs", "desk"}, true},
+		{"alias", []string{"alias", "lamp", "desk"}, true},
+		{"scene", []string{"scene", "reading", "desk"}, true},
+		{"light command", []string{"on", "desk"}, false},
+	} {
+		cmd, _, err := rootCmd.Find(test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isConfigOnly(cmd); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
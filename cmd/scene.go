@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var sceneCmd = &cobra.Command{
+	Use:         "scene [scene] [name/IP]",
+	Annotations: configOnly,
+	Short:       "Apply a scene of the configuration to a given light",
+	Long: `Apply a scene of the configuration to a given light.
+Scenes are saved in the "scenes" of the configuration file, a scene sets
+the power, the brightness and one of the color temperature, the color or the flow.
+Without arguments, the saved scenes are listed.`,
+	Example: `yeego scene
+yeego scene reading bedroom`,
+	ValidArgsFunction: completeArgs(completeScenes, completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			names := sortedKeys(scenes)
+			entries := make([]sceneEntry, len(names))
+			for i, name := range names {
+				entries[i] = sceneEntry{Name: name, scene: scenes[name]}
+			}
+
+			return render(entries, func() {
+				fmt.Printf("%v scenes saved in configuration:\n", len(names))
+				for _, name := range names {
+					fmt.Printf("- %s\n", name)
+				}
+			}, func(w io.Writer) {
+				fmt.Fprintln(w, "SCENE\tPOWER\tBRIGHT\tCT\tCOLOR\tFLOW")
+				for _, e := range entries {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, e.Power, number(e.Bright), number(e.CT), e.Color, e.Flow)
+				}
+			})
+		}
+
+		s, ok := scenes[args[0]]
+		if !ok {
+			return fmt.Errorf("Scene %s not found", args[0])
+		}
+
+		if len(args) < 2 {
+			return fmt.Errorf("Please enter the light to apply %s to", args[0])
+		}
+
+		return forEachLight(args[1], "set to "+args[0], func(light *yeelight.Yeelight) error {
+			return s.apply(context.Background(), light)
+		})
+	},
+}
+
+// sceneEntry is a scene as printed by the structured output formats
+type sceneEntry struct {
+	Name string `json:"name"`
+	scene
+}
+
+func init() {
+	rootCmd.AddCommand(sceneCmd)
+}
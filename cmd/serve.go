@@ -0,0 +1,498 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/julienrbrt/yeego/internal/daemon"
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// serveListen is the address of the HTTP server
+	serveListen string
+
+	// serveToken is the bearer token expected by the HTTP server
+	serveToken string
+
+	// serveOrigins are the origins allowed to call the HTTP server from a browser
+	serveOrigins []string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the lights, groups and scenes over HTTP",
+	Long: `Serve the lights, groups and scenes as HTTP resources:
+	GET /lights, /groups and /scenes list them, GET /lights/{light} returns one of them,
+	PUT and PATCH /lights/{light}/state change the state: power, bright, ct, color and duration,
+	POST /lights/{light}/toggle, /flow and /adjust run an action,
+	the same for the groups under /groups/{group},
+	POST /scenes/{scene}/apply applies a scene to a target,
+	GET /events streams the changes of the lights as Server-Sent Events,
+	GET /openapi.json describes the API.
+The server listens on this machine only, a token is required to listen on other addresses.
+With a token, given by --token or YEEGO_TOKEN, the requests must carry it
+in an "Authorization: Bearer" header, or in the access_token parameter for /events.`,
+	Example: `yeego serve
+yeego serve --listen :8080 --token secret
+curl -H "Authorization: Bearer secret" localhost:8080/lights/bedroom
+curl -X PATCH -H "Authorization: Bearer secret" -d '{"bright": 40}' localhost:8080/lights/bedroom/state`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serveToken == "" {
+			serveToken = os.Getenv("YEEGO_TOKEN")
+		}
+		if serveToken == "" && !loopback(serveListen) {
+			return fmt.Errorf("A token is required to listen on %s, beyond this machine", serveListen)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		api := &httpAPI{
+			registry: daemon.NewRegistry(yeelight.DefaultClient, lights, 5*time.Second),
+			token:    serveToken,
+			origins:  serveOrigins,
+		}
+		go api.registry.Run(ctx)
+
+		ln, err := net.Listen("tcp", serveListen)
+		if err != nil {
+			return err
+		}
+
+		server := &http.Server{
+			Handler:           api.handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+			// the event streams end with the server
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+		context.AfterFunc(ctx, func() {
+			shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdown)
+		})
+
+		info("Serving on http://%s\n", ln.Addr())
+		if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+
+		return nil
+	},
+}
+
+// loopback reports whether the listen address only accepts connections from this machine
+func loopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// httpAPI serves the lights kept by the registry
+type httpAPI struct {
+	registry *daemon.Registry
+	token    string
+	origins  []string
+}
+
+// httpError is an error returned with its HTTP status
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return httpError{http.StatusBadRequest, fmt.Errorf(format, a...)}
+}
+
+func notFound(format string, a ...interface{}) error {
+	return httpError{http.StatusNotFound, fmt.Errorf(format, a...)}
+}
+
+// lightResource is a light as returned by the HTTP API
+type lightResource struct {
+	ID        string            `json:"id,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Address   string            `json:"address"`
+	Room      string            `json:"room,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Connected bool              `json:"connected"`
+	Updated   time.Time         `json:"updated"`
+	State     yeelight.Yeelight `json:"state"`
+}
+
+// groupResource is a group as returned by the HTTP API
+type groupResource struct {
+	Name    string          `json:"name"`
+	Members []string        `json:"members"`
+	Lights  []lightResource `json:"lights"`
+}
+
+// stateRequest is the state wanted for lights, PUT requires the power
+type stateRequest struct {
+	Power    string `json:"power,omitempty" enum:"on,off"`
+	Bright   int    `json:"bright,omitempty"`
+	CT       int    `json:"ct,omitempty"`
+	Color    string `json:"color,omitempty"`    // hexadecimal or named color
+	Duration int    `json:"duration,omitempty"` // of the transition, in milliseconds
+}
+
+// flowRequest starts a color flow, the flow is an expression in milliseconds or a preset
+type flowRequest struct {
+	Count  int    `json:"count"`
+	Action string `json:"action,omitempty" enum:"recover-state,keep-state,turn-off"`
+	Flow   string `json:"flow"`
+}
+
+// adjustRequest changes a property without knowing its value
+type adjustRequest struct {
+	Action   string `json:"action" enum:"increase,decrease,circle"`
+	Property string `json:"property" enum:"bright,ct,color"`
+}
+
+// applyRequest applies a scene to lights
+type applyRequest struct {
+	Target string `json:"target"`
+}
+
+// apiError is the body of the failed requests
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// handler returns the routes of the API behind CORS and authentication
+func (a *httpAPI) handler() http.Handler {
+	routes := a.routes()
+	spec, _ := json.MarshalIndent(openAPI(routes), "", "  ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.cors(w, r) {
+			return
+		}
+
+		if r.URL.Path == "/openapi.json" && r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(spec)
+			return
+		}
+
+		if !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, apiError{"Invalid or missing bearer token"})
+			return
+		}
+
+		allowed := false
+		for _, rt := range routes {
+			params, ok := rt.match(r.URL.Path)
+			if !ok {
+				continue
+			}
+			if rt.method != r.Method {
+				allowed = true
+				continue
+			}
+
+			if err := rt.handle(w, r, params); err != nil {
+				status := http.StatusBadGateway
+				var httpErr httpError
+				if errors.As(err, &httpErr) {
+					status = httpErr.status
+				}
+				writeJSON(w, status, apiError{err.Error()})
+			}
+			return
+		}
+
+		if allowed {
+			writeJSON(w, http.StatusMethodNotAllowed, apiError{"Method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusNotFound, apiError{"Not found"})
+	})
+}
+
+// cors sets the CORS headers of the allowed origins, and answers the preflight requests
+func (a *httpAPI) cors(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		for _, allowed := range a.origins {
+			if allowed == "*" || allowed == origin {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, PATCH, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				break
+			}
+		}
+		w.Header().Add("Vary", "Origin")
+	}
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+
+	return true
+}
+
+// authorized checks the bearer token, the browsers cannot set it for the event streams
+func (a *httpAPI) authorized(r *http.Request) bool {
+	if a.token == "" {
+		return true
+	}
+
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		given = ""
+	}
+	if r.URL.Path == "/events" && r.URL.Query().Has("access_token") {
+		given = r.URL.Query().Get("access_token")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(given), []byte(a.token)) == 1
+}
+
+// lightsOf returns the lights of a light or a group, bound to the registry
+func (a *httpAPI) lightsOf(kind, name string) ([]*yeelight.Yeelight, error) {
+	var matched []*yeelight.Yeelight
+	switch kind {
+	case "light":
+		light, err := argToYeelight(name)
+		if err != nil {
+			return nil, notFound("Light %s not found", name)
+		}
+		matched = []*yeelight.Yeelight{light}
+	case "group":
+		if _, ok := groups[name]; !ok {
+			return nil, notFound("Group %s not found", name)
+		}
+
+		var err error
+		if matched, err = resolveTargets("group:" + name); err != nil {
+			return nil, err
+		}
+	}
+
+	bound := make([]*yeelight.Yeelight, len(matched))
+	for i, light := range matched {
+		bound[i] = a.registry.Light(light.Location)
+	}
+
+	return bound, nil
+}
+
+func (a *httpAPI) resource(light *yeelight.Yeelight) lightResource {
+	status, ok := a.registry.Status(light.Location)
+	if !ok {
+		status.Light = *light
+	}
+
+	r := lightResource{
+		ID:        status.Light.ID,
+		Name:      status.Light.Name,
+		Address:   address(&status.Light),
+		Connected: status.Connected,
+		Updated:   status.Updated,
+		State:     status.Light,
+	}
+	if m, ok := meta[lightLabel(&status.Light)]; ok {
+		r.Room, r.Tags = m.Room, m.Tags
+	}
+
+	return r
+}
+
+func (a *httpAPI) group(name string) (groupResource, error) {
+	matched, err := a.lightsOf("group", name)
+	if err != nil {
+		return groupResource{}, err
+	}
+
+	g := groupResource{Name: name, Members: groups[name], Lights: make([]lightResource, len(matched))}
+	for i, light := range matched {
+		g.Lights[i] = a.resource(light)
+	}
+
+	return g, nil
+}
+
+// run runs the action on the lights and writes their results, with their new state
+func (a *httpAPI) run(w http.ResponseWriter, matched []*yeelight.Yeelight, action string, fn func(light *yeelight.Yeelight) error) error {
+	errs := runOnLights(matched, func(_ int, light *yeelight.Yeelight) error {
+		return fn(light)
+	})
+
+	results := make([]result, len(matched))
+	status := http.StatusBadGateway
+	for i, light := range matched {
+		current, _ := a.registry.Status(light.Location)
+		results[i] = newResult(light, action, errs[i]).withState(&current.Light)
+		if errs[i] == nil {
+			status = http.StatusOK
+		}
+	}
+
+	writeJSON(w, status, results)
+	return nil
+}
+
+// setState changes the state of a light, the lights must be on to change their color
+func setState(light *yeelight.Yeelight, req stateRequest) error {
+	if req.Power != "" {
+		if _, err := light.SetPower(req.Power, req.Duration); err != nil || req.Power == "off" {
+			return err
+		}
+	}
+
+	if req.CT != 0 {
+		if _, err := light.SetCtAbx(req.CT, req.Duration); err != nil {
+			return err
+		}
+	}
+
+	if req.Color != "" {
+		rgb, _ := parseColor(req.Color)
+		if _, err := light.SetRGBhex(rgb, req.Duration); err != nil {
+			return err
+		}
+	}
+
+	if req.Bright != 0 {
+		if _, err := light.SetBright(req.Bright, req.Duration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (req stateRequest) validate(full bool) error {
+	switch {
+	case full && req.Power == "":
+		return badRequest("The power is mandatory, use PATCH to change only some properties")
+	case req == stateRequest{} || req == stateRequest{Duration: req.Duration}:
+		return badRequest("Nothing to change")
+	case req.Power != "" && req.Power != "on" && req.Power != "off":
+		return badRequest("Invalid power %q, must be on or off", req.Power)
+	case req.Bright < 0 || req.Bright > 100:
+		return badRequest("Invalid brightness %d, must be between 1 and 100", req.Bright)
+	case req.CT != 0 && (req.CT < 1700 || req.CT > 6500):
+		return badRequest("Invalid color temperature %d, must be between 1700 and 6500", req.CT)
+	case req.CT != 0 && req.Color != "":
+		return badRequest("Color temperature and color cannot be set together")
+	case req.Duration < 0:
+		return badRequest("Invalid duration %d", req.Duration)
+	}
+
+	if req.Color != "" {
+		if _, err := parseColor(req.Color); err != nil {
+			return badRequest("%w", err)
+		}
+	}
+
+	return nil
+}
+
+// flowAction returns the value of the action after a flow
+func flowAction(action string) (int, error) {
+	switch action {
+	case "", "recover-state":
+		return 0, nil
+	case "keep-state":
+		return 1, nil
+	case "turn-off":
+		return 2, nil
+	default:
+		return 0, badRequest("Invalid action %q, must be recover-state, keep-state or turn-off", action)
+	}
+}
+
+// decodeBody reads the JSON body of a request
+func decodeBody(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return badRequest("Invalid body: %w", err)
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// events streams the changes of the lights, starting with their current state
+func (a *httpAPI) events(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("Streaming is not supported")
+	}
+
+	changes := a.registry.Subscribe(r.Context())
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(status daemon.LightStatus) {
+		data, _ := json.Marshal(a.resource(&status.Light))
+		fmt.Fprintf(w, "event: state\ndata: %s\n\n", data)
+	}
+
+	for _, status := range a.registry.Lights() {
+		send(status)
+	}
+	flusher.Flush()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case status, ok := <-changes:
+			if !ok {
+				return nil
+			}
+			send(status)
+		case <-ping.C:
+			// keeps the proxies from closing the stream
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8080", "Address to listen on, a token is required beyond the loopback")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "Bearer token required by the API, default $YEEGO_TOKEN")
+	serveCmd.Flags().StringSliceVar(&serveOrigins, "cors-origin", nil, "Origins allowed to call the API from a browser, * for all")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienrbrt/yeego/internal/daemon"
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+// testAPI serves a desk light recording the commands
+func testAPI(t *testing.T, token string, origins ...string) (http.Handler, func() []string) {
+	saved := lights
+	t.Cleanup(func() { lights = saved })
+	lights = []yeelight.Yeelight{{ID: "0x01", Name: "desk", Location: "10.0.0.1:55443", Model: "color", Power: "off"}}
+
+	client, sent := recordingClient()
+	api := &httpAPI{
+		registry: daemon.NewRegistry(client, lights, time.Minute),
+		token:    token,
+		origins:  origins,
+	}
+
+	return api.handler(), sent
+}
+
+func TestServeAuthorization(t *testing.T) {
+	handler, _ := testAPI(t, "secret")
+
+	for _, test := range []struct {
+		path, authorization string
+		status              int
+	}{
+		{"/lights", "", http.StatusUnauthorized},
+		{"/lights", "Bearer wrong", http.StatusUnauthorized},
+		{"/lights", "secret", http.StatusUnauthorized},
+		{"/lights", "Bearer secret", http.StatusOK},
+		{"/events?access_token=wrong", "", http.StatusUnauthorized},
+		// the specification describes the API to anyone
+		{"/openapi.json", "", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.status {
+			t.Errorf("%s with %q: got %d, want %d", test.path, test.authorization, rec.Code, test.status)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%s with %q: no WWW-Authenticate header", test.path, test.authorization)
+		}
+	}
+}
+
+func TestServeCORS(t *testing.T) {
+	handler, _ := testAPI(t, "secret", "https://allowed.example")
+
+	for _, test := range []struct {
+		origin, allowed string
+	}{
+		{"https://allowed.example", "https://allowed.example"},
+		{"https://other.example", ""},
+	} {
+		// the preflight requests carry no token
+		req := httptest.NewRequest(http.MethodOptions, "/lights/desk/state", nil)
+		req.Header.Set("Origin", test.origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s: got %d, want %d", test.origin, rec.Code, http.StatusNoContent)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != test.allowed {
+			t.Errorf("%s: allowed origin %q, want %q", test.origin, got, test.allowed)
+		}
+		if test.allowed != "" && !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "Authorization") {
+			t.Errorf("%s: Authorization header not allowed", test.origin)
+		}
+	}
+}
+
+func TestServeLightState(t *testing.T) {
+	handler, sent := testAPI(t, "")
+
+	req := httptest.NewRequest(http.MethodPatch, "/lights/desk/state", strings.NewReader(`{"power": "on", "bright": 40, "duration": 500}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	if want := []string{"set_power[on smooth 500]", "set_bright[40 smooth 500]"}; !reflect.DeepEqual(sent(), want) {
+		t.Errorf("got %v sent, want %v", sent(), want)
+	}
+
+	var results []struct {
+		Error string            `json:"error"`
+		State yeelight.Yeelight `json:"state"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Error != "" || results[0].State.Power != "on" || results[0].State.Bright != 40 {
+		t.Errorf("got results %+v", results)
+	}
+
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPatch, "/lights/desk/state", `{"bright": 101}`, http.StatusBadRequest},
+		{http.MethodPut, "/lights/desk/state", `{"bright": 40}`, http.StatusBadRequest},
+		{http.MethodPatch, "/lights/desk/state", `{"brightness": 40}`, http.StatusBadRequest},
+		{http.MethodPatch, "/lights/kitchen/state", `{"bright": 40}`, http.StatusNotFound},
+		{http.MethodDelete, "/lights/desk/state", "", http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+		if rec.Code != test.status {
+			t.Errorf("%s %s %s: got %d, want %d", test.method, test.path, test.body, rec.Code, test.status)
+		}
+	}
+	if len(sent()) != 2 {
+		t.Errorf("got %v sent by the invalid requests", sent()[2:])
+	}
+}
+
+func TestServeLoopback(t *testing.T) {
+	for listen, want := range map[string]bool{
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		"localhost:8080": true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.2:8080":  false,
+		"8080":           false,
+	} {
+		if got := loopback(listen); got != want {
+			t.Errorf("%s: got %v, want %v", listen, got, want)
+		}
+	}
+}
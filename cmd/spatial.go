@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// spatial effect built from the flags
+	spatialEffect yeelight.SpatialEffect
+	// colors of the spatial effect in hexadecimal
+	spatialColor, spatialBackground string
+	// center of pulses, normalized
+	spatialCenter []float64
+	// frame rate of the spatial effect
+	spatialFPS float64
+	// how long the spatial effect runs, 0 until interrupted
+	spatialDuration time.Duration
+)
+
+var placeCmd = &cobra.Command{
+	Use:         "place [name/IP] [x] [y]",
+	Annotations: configOnly,
+	Short:       "Save the position of a light in the room",
+	Long: `Save the position of a light in the room, used by spatial effects.
+The unit does not matter as long as all the lights use the same one.`,
+	Example: `yeego place corridor-1 0 0
+yeego place corridor-2 2.5 0`,
+	Args:              cobra.MinimumNArgs(3),
+	ValidArgsFunction: completeArgs(completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		light, err := argToYeelight(args[0])
+		if err != nil {
+			return err
+		}
+
+		x, errX := strconv.ParseFloat(args[1], 64)
+		y, errY := strconv.ParseFloat(args[2], 64)
+		if errX != nil || errY != nil {
+			return errors.New("Position must be two numbers")
+		}
+
+		layout[lightLabel(light)] = yeelight.Point{X: x, Y: y}
+		if err := writeConfig(&lights); err != nil {
+			return err
+		}
+
+		return printResults([]result{newResult(light, currentAction, nil)}, func() {
+			fmt.Printf("%s placed at (%v, %v)\n", args[0], x, y)
+		})
+	},
+}
+
+var spatialCmd = &cobra.Command{
+	Use:   "spatial [wave|sweep|pulse|gradient] [name/IP...]",
+	Short: "Play an effect moving across the room",
+	Long: `Play an effect computed from the position of the lights, saved with "yeego place".
+Without lights given, all the placed lights are used.
+	"wave" is a sine wave of colors moving across the room.
+	"sweep" is a band of light crossing the room, like a chaser along a corridor.
+	"pulse" is rings of light expanding from the center.
+	"gradient" is a gradient of colors scrolling across the room.`,
+	Example: `yeego spatial sweep --color ff0000 --speed 0.5
+yeego spatial pulse --center 0.5,0.5 --width 0.2
+yeego spatial wave corridor-1 corridor-2 corridor-3 --angle 90`,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeRest(completeTargets, completeValues("wave", "sweep", "pulse", "gradient")),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		effect := spatialEffect
+		effect.Kind = yeelight.SpatialKind(args[0])
+
+		color, err := parseColor(spatialColor)
+		if err != nil {
+			return err
+		}
+		background, err := parseColor(spatialBackground)
+		if err != nil {
+			return err
+		}
+		effect.Color, effect.Background = color, background
+
+		if len(spatialCenter) != 2 {
+			return errors.New("Center must be two numbers: x,y")
+		}
+		effect.Center = yeelight.Point{X: spatialCenter[0], Y: spatialCenter[1]}
+
+		var placed []yeelight.PlacedLight
+		if len(args) == 1 {
+			for _, name := range sortedKeys(layout) {
+				light, err := argToYeelight(name)
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				placed = append(placed, yeelight.PlacedLight{Light: light, Position: layout[name]})
+			}
+		}
+
+		for _, arg := range args[1:] {
+			matched, err := resolveTargets(arg)
+			if err != nil {
+				return err
+			}
+
+			for _, light := range matched {
+				position, ok := positionOf(light)
+				if !ok {
+					return fmt.Errorf("%s has no position, use `yeego place` first", lightLabel(light))
+				}
+				placed = append(placed, yeelight.PlacedLight{Light: light, Position: position})
+			}
+		}
+
+		if len(placed) == 0 {
+			return errors.New("No light placed, use `yeego place` first")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		err = yeelight.PlaySpatial(ctx, effect, placed, spatialFPS, spatialDuration, "")
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+
+		return err
+	},
+}
+
+// positionOf returns the position of a light saved by its name, its IP or one of its aliases
+func positionOf(light *yeelight.Yeelight) (yeelight.Point, bool) {
+	for _, name := range lightNames(light) {
+		if position, ok := layout[name]; ok {
+			return position, true
+		}
+	}
+
+	return yeelight.Point{}, false
+}
+
+func init() {
+	spatialCmd.Flags().StringVar(&spatialColor, "color", "ff0000", "Color of the effect in hexadecimal or by name")
+	spatialCmd.Flags().StringVar(&spatialBackground, "background", "000000", "Color of the lights outside of the effect in hexadecimal or by name")
+	spatialCmd.RegisterFlagCompletionFunc("color", completeFlag(completeColors))
+	spatialCmd.RegisterFlagCompletionFunc("background", completeFlag(completeColors))
+	spatialCmd.Flags().IntVar(&spatialEffect.Bright, "bright", 100, "Brightness of the lights")
+	spatialCmd.Flags().Float64Var(&spatialEffect.Angle, "angle", 0, "Direction of the effect in degrees, 0 goes along the X axis")
+	spatialCmd.Flags().Float64Var(&spatialEffect.Speed, "speed", 0.25, "Room crossings per second")
+	spatialCmd.Flags().Float64Var(&spatialEffect.Width, "width", 0.3, "Width of the effect as a fraction of the room")
+	spatialCmd.Flags().Float64SliceVar(&spatialCenter, "center", []float64{0.5, 0.5}, "Origin of pulses as a fraction of the room: x,y")
+	spatialCmd.Flags().Float64Var(&spatialFPS, "fps", 10, "Frames sent per second")
+	spatialCmd.Flags().DurationVar(&spatialDuration, "duration", 0, "Duration of the effect, 0 plays it until interrupted")
+
+	rootCmd.AddCommand(placeCmd)
+	rootCmd.AddCommand(spatialCmd)
+}
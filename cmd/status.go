@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// statusDeadline is how long the lights have to answer
+	statusDeadline time.Duration
+
+	// statusWatch refreshes the status until interrupted
+	statusWatch bool
+
+	// statusInterval is the time between two refreshes with --watch
+	statusInterval time.Duration
+)
+
+// statusEntry is the status of a light as printed by the structured output formats
+type statusEntry struct {
+	Name       string   `json:"name,omitempty"`
+	Address    string   `json:"address"`
+	Reachable  bool     `json:"reachable"`
+	Error      string   `json:"error,omitempty"`
+	Latency    duration `json:"latency,omitempty"`
+	Power      string   `json:"power,omitempty"`
+	Mode       string   `json:"mode,omitempty"`
+	Bright     int      `json:"bright,omitempty"`
+	ColorTemp  int      `json:"ct,omitempty"`
+	RGB        string   `json:"rgb,omitempty"`
+	Flowing    bool     `json:"flowing"`
+	SleepTimer duration `json:"sleep_timer,omitempty"`
+	Firmware   int      `json:"fw_ver,omitempty"`
+
+	display int // color shown by the light
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status [name/IP]",
+	Short: "Show the status of all the lights",
+	Long: `Show the status of all the saved lights, or of the given ones, in a table:
+reachability, latency, power, color mode, brightness, color, color flow, sleep timer and firmware.
+The lights which do not answer before the deadline are shown as unreachable.`,
+	Example: `yeego status
+yeego status upstairs --watch`,
+	ValidArgsFunction: completeArgs(completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target := "all"
+		if len(args) > 0 {
+			target = args[0]
+		}
+
+		matched, err := resolveTargets(target)
+		if err != nil {
+			return err
+		}
+		stateRefreshed = true
+
+		if !statusWatch {
+			return printStatus(queryStatus(context.Background(), matched))
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		ticker := time.NewTicker(statusInterval)
+		defer ticker.Stop()
+
+		for {
+			entries := queryStatus(ctx, matched)
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if terminal() && !structured() {
+				// move to the top left corner and clear the screen
+				fmt.Print("\x1b[H\x1b[2J")
+			}
+			if err := printStatus(entries); err != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// queryStatus gets the status of the lights concurrently, each light has statusDeadline to answer
+func queryStatus(ctx context.Context, matched []*yeelight.Yeelight) []statusEntry {
+	entries := make([]statusEntry, len(matched))
+	runOnLights(matched, func(i int, light *yeelight.Yeelight) error {
+		ctx, cancel := context.WithTimeout(ctx, statusDeadline)
+		defer cancel()
+
+		status, err := light.Status(ctx)
+		entries[i] = newStatusEntry(light, status, err)
+		return err
+	})
+
+	return entries
+}
+
+func newStatusEntry(light *yeelight.Yeelight, status yeelight.Status, err error) statusEntry {
+	entry := statusEntry{
+		Name:     light.Name,
+		Address:  strings.Split(light.Location, ":")[0],
+		Firmware: light.FWVersion,
+	}
+
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errors.New("No answer")
+		}
+		entry.Error = err.Error()
+		return entry
+	}
+
+	s := status.Light
+	entry.Reachable = true
+	entry.Latency = duration(status.Latency)
+	entry.Power, entry.Mode, entry.Bright = s.Power, colorMode(s.ColorMode), s.Bright
+	entry.Flowing, entry.SleepTimer = status.Flowing, duration(status.SleepTimer)
+	entry.display = s.DisplayRGB()
+	switch s.ColorMode {
+	case 2:
+		entry.ColorTemp = s.ColorTemp
+	default:
+		entry.RGB = hexColor(entry.display)
+	}
+
+	return entry
+}
+
+func printStatus(entries []statusEntry) error {
+	return render(entries, func() {
+		writeColumns(os.Stdout, statusRows(entries, terminal() && os.Getenv("NO_COLOR") == ""))
+	}, func(w io.Writer) {
+		for _, row := range statusRows(entries, false) {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+	})
+}
+
+// statusRows returns the header and a row for each light, with a block of the color of the light
+func statusRows(entries []statusEntry, swatch bool) [][]string {
+	rows := [][]string{{"LIGHT", "ADDRESS", "STATUS", "LATENCY", "POWER", "MODE", "BRIGHT", "COLOR", "FLOW", "SLEEP", "FW"}}
+	for _, e := range entries {
+		if !e.Reachable {
+			rows = append(rows, []string{e.Name, e.Address, "offline", e.Error})
+			continue
+		}
+
+		color := e.RGB
+		if e.ColorTemp != 0 {
+			color = fmt.Sprintf("%dK", e.ColorTemp)
+		}
+		if swatch {
+			rgb := e.display
+			color = fmt.Sprintf("\x1b[48;2;%d;%d;%dm  \x1b[0m %s", rgb>>16&0xff, rgb>>8&0xff, rgb&0xff, color)
+		}
+
+		flow, sleep := "", ""
+		if e.Flowing {
+			flow = "yes"
+		}
+		if e.SleepTimer > 0 {
+			sleep = time.Duration(e.SleepTimer).String()
+		}
+
+		rows = append(rows, []string{
+			e.Name, e.Address, "online", fmt.Sprintf("%dms", time.Duration(e.Latency).Milliseconds()),
+			e.Power, e.Mode, number(e.Bright), color, flow, sleep, number(e.Firmware),
+		})
+	}
+
+	return rows
+}
+
+// writeColumns aligns the rows as tabwriter does, ignoring the width of the terminal escape sequences
+func writeColumns(w io.Writer, rows [][]string) {
+	// as with tabwriter, the last cell of a row is not part of a column
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row[:len(row)-1] {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := visibleWidth(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-visibleWidth(cell)+2))
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+	}
+}
+
+// visibleWidth returns the number of characters shown by the terminal
+func visibleWidth(s string) int {
+	n, escape := 0, false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			escape = true
+		case escape:
+			escape = r != 'm'
+		default:
+			n++
+		}
+	}
+
+	return n
+}
+
+// terminal is true when the output is a terminal rather than a file or a pipe
+func terminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func init() {
+	statusCmd.Flags().DurationVar(&statusDeadline, "deadline", time.Second, "Time given to each light to answer")
+	statusCmd.Flags().BoolVarP(&statusWatch, "watch", "w", false, "Refresh the status until interrupted")
+	statusCmd.Flags().DurationVar(&statusInterval, "interval", 2*time.Second, "Time between two refreshes with --watch")
+	rootCmd.AddCommand(statusCmd)
+}
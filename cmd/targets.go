@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+// lightMeta is the information saved about a light, by name or IP
+type lightMeta struct {
+	Room string   `json:"room,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// lightLabel is how a light is named in the messages and the configuration
+func lightLabel(light *yeelight.Yeelight) string {
+	if light.Name != "" {
+		return light.Name
+	}
+
+	return strings.Split(light.Location, ":")[0]
+}
+
+// resolveTargets returns the lights matched by an expression, which is a comma list of:
+// a name, an alias or an IP, a group, a room, a tag, a glob on the names and IPs or "all".
+// "group:", "room:" and "tag:" prefixes force how a part is read.
+func resolveTargets(expr string) ([]*yeelight.Yeelight, error) {
+	var matched []*yeelight.Yeelight
+	seen := make(map[string]bool)
+	add := func(light *yeelight.Yeelight) {
+		if !seen[light.Location] {
+			seen[light.Location] = true
+			matched = append(matched, light)
+		}
+	}
+
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		found, err := resolvePart(part, make(map[string]bool))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, light := range found {
+			add(light)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, errYeelightNotFound
+	}
+
+	return matched, nil
+}
+
+// resolvePart returns the lights matched by one part of a target expression
+// visited prevents groups containing each other from looping
+func resolvePart(part string, visited map[string]bool) ([]*yeelight.Yeelight, error) {
+	kind, name := "", part
+	if i := strings.Index(part, ":"); i > 0 && net.ParseIP(part) == nil {
+		kind, name = part[:i], part[i+1:]
+	}
+
+	switch kind {
+	case "":
+	case "group":
+		return resolveGroup(name, visited)
+	case "room":
+		return resolveMeta(name, func(m lightMeta) bool { return m.Room == name })
+	case "tag":
+		return resolveMeta(name, func(m lightMeta) bool { return hasTag(m, name) })
+	default:
+		return nil, fmt.Errorf("Unknown target %q, use group:, room: or tag:", kind)
+	}
+
+	if part == "all" {
+		matched := make([]*yeelight.Yeelight, len(lights))
+		for i := range lights {
+			matched[i] = &lights[i]
+		}
+		return matched, nil
+	}
+
+	if light, err := argToYeelight(part); err == nil {
+		return []*yeelight.Yeelight{light}, nil
+	}
+
+	if _, ok := groups[part]; ok {
+		return resolveGroup(part, visited)
+	}
+
+	if light, err := resolveMeta(part, func(m lightMeta) bool { return m.Room == part }); err == nil {
+		return light, nil
+	}
+
+	if light, err := resolveMeta(part, func(m lightMeta) bool { return hasTag(m, part) }); err == nil {
+		return light, nil
+	}
+
+	if strings.ContainsAny(part, "*?[") {
+		return resolveGlob(part)
+	}
+
+	return nil, fmt.Errorf("%w: %s", errNotFoundLight, part)
+}
+
+// resolveGroup returns the lights of a group, which may contain other groups
+func resolveGroup(name string, visited map[string]bool) ([]*yeelight.Yeelight, error) {
+	members, ok := groups[name]
+	if !ok {
+		return nil, fmt.Errorf("Group %s not found", name)
+	}
+
+	if visited[name] {
+		return nil, fmt.Errorf("Group %s contains itself", name)
+	}
+	visited[name] = true
+	defer delete(visited, name)
+
+	var matched []*yeelight.Yeelight
+	for _, member := range members {
+		found, err := resolvePart(member, visited)
+		if err != nil {
+			return nil, fmt.Errorf("Group %s: %w", name, err)
+		}
+		matched = append(matched, found...)
+	}
+
+	return matched, nil
+}
+
+// resolveMeta returns the lights whose metadata matches
+func resolveMeta(name string, match func(lightMeta) bool) ([]*yeelight.Yeelight, error) {
+	var matched []*yeelight.Yeelight
+	for _, key := range sortedKeys(meta) {
+		if !match(meta[key]) {
+			continue
+		}
+
+		light, err := argToYeelight(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		matched = append(matched, light)
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: %s", errNotFoundLight, name)
+	}
+
+	return matched, nil
+}
+
+// resolveGlob returns the lights whose name, IP or alias matches the pattern
+func resolveGlob(pattern string) ([]*yeelight.Yeelight, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("Invalid pattern %s: %w", pattern, err)
+	}
+
+	var matched []*yeelight.Yeelight
+	for i := range lights {
+		if globMatch(pattern, &lights[i]) {
+			matched = append(matched, &lights[i])
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: %s", errNotFoundLight, pattern)
+	}
+
+	return matched, nil
+}
+
+func globMatch(pattern string, light *yeelight.Yeelight) bool {
+	for _, name := range lightNames(light) {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lightNames returns the name, the IP and the aliases of a light
+func lightNames(light *yeelight.Yeelight) []string {
+	ip := strings.Split(light.Location, ":")[0]
+	names := []string{ip}
+	if light.Name != "" {
+		names = append(names, light.Name)
+	}
+
+	for _, alias := range sortedKeys(aliases) {
+		if target := aliases[alias]; target == ip || (target == light.Name && target != "") {
+			names = append(names, alias)
+		}
+	}
+
+	return names
+}
+
+func hasTag(m lightMeta, tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forEachLight runs fn concurrently on the lights matched by the target expression,
+// then prints done or the error for each light in order
+func forEachLight(target, done string, fn func(light *yeelight.Yeelight) error) error {
+	matched, err := resolveTargets(target)
+	if err != nil {
+		return err
+	}
+
+	// the structured formats give the state resulting of the command
+	stateRefreshed = structured()
+
+	results := make([]result, len(matched))
+	errs := runOnLights(matched, func(i int, light *yeelight.Yeelight) error {
+		err := fn(light)
+		results[i] = newResult(light, currentAction, err)
+		if err == nil && stateRefreshed && light.GetProp() == nil {
+			results[i] = results[i].withState(light)
+		}
+
+		return err
+	})
+
+	// a single light fails as before, with only the error
+	if len(matched) == 1 && errs[0] != nil && !structured() {
+		return errs[0]
+	}
+
+	err = printResults(results, func() {
+		for i, light := range matched {
+			if errs[i] != nil {
+				fmt.Printf("%s: %v\n", lightLabel(light), errs[i])
+				continue
+			}
+
+			fmt.Printf("%s %s\n", lightLabel(light), done)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(matched) == 1 {
+		return errs[0]
+	}
+
+	return failedLights(errs)
+}
+
+// runOnLights runs fn concurrently on the lights and returns their errors in the same order
+func runOnLights(matched []*yeelight.Yeelight, fn func(i int, light *yeelight.Yeelight) error) []error {
+	errs := make([]error, len(matched))
+
+	var wg sync.WaitGroup
+	for i, light := range matched {
+		wg.Add(1)
+		go func(i int, light *yeelight.Yeelight) {
+			defer wg.Done()
+			errs[i] = fn(i, light)
+		}(i, light)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// failedLights returns an error counting the lights which failed, if any
+func failedLights(errs []error) error {
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d lights failed", failed, len(errs))
+	}
+
+	return nil
+}
@@ -9,11 +9,20 @@ import (
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the Yeego version number",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Yeego v0.1.2")
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v := struct {
+			Version string `json:"version"`
+		}{version}
+
+		return render(v, func() {
+			fmt.Printf("Yeego %s\n", version)
+		}, nil)
 	},
 }
 
+// version is the version of yeego
+const version = "v0.1.2"
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
 }
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+	"github.com/spf13/cobra"
+)
+
+// watchReconnect is the time between two connections to a light which went offline
+var watchReconnect time.Duration
+
+// event is something that happened to a light, printed by yeego watch
+type event struct {
+	Time     time.Time         `json:"time"`
+	Type     string            `json:"type"`
+	ID       string            `json:"id,omitempty"`
+	Name     string            `json:"name,omitempty"`
+	Address  string            `json:"address"`
+	Previous string            `json:"previous,omitempty"` // address before an address change
+	Props    map[string]string `json:"props,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// event types
+const (
+	eventProps         = "props"
+	eventAdvertisement = "advertisement"
+	eventOnline        = "online"
+	eventOffline       = "offline"
+	eventAddress       = "address"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [name/IP...]",
+	Short: "Print the events of the lights as they happen",
+	Long: `Keep a connection open to the lights and print, timestamped, as they happen:
+	"props" when properties of a light change, whoever changed them,
+	"advertisement" when a light announces itself on the network,
+	"online" and "offline" when a light becomes reachable or unreachable,
+	"address" when a light comes back with another IP.
+Without lights given, all the saved lights are watched.
+With --output json, each event is printed as a JSON object on its own line.`,
+	Example: `yeego watch
+yeego watch bedroom upstairs --output json | jq 'select(.type == "props")'`,
+	ValidArgsFunction: completeRest(completeTargets),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if outputFormat == "table" {
+			return fmt.Errorf("Output table is not supported by %s", currentAction)
+		}
+
+		if len(args) == 0 {
+			args = []string{"all"}
+		}
+
+		var watched []*watchedLight
+		for _, arg := range args {
+			matched, err := resolveTargets(arg)
+			if err != nil {
+				return err
+			}
+
+			for _, light := range matched {
+				watched = append(watched, &watchedLight{light: light, wake: make(chan struct{}, 1)})
+			}
+		}
+		stateRefreshed = true
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		var wg sync.WaitGroup
+		for _, w := range watched {
+			wg.Add(1)
+			go func(w *watchedLight) {
+				defer wg.Done()
+				w.run(ctx)
+			}(w)
+		}
+
+		err := yeelight.DefaultClient.Advertisements(ctx, func(ad yeelight.Yeelight) {
+			emit(event{Type: eventAdvertisement, ID: ad.ID, Name: ad.Name, Address: address(&ad)})
+			for _, w := range watched {
+				w.advertised(ad)
+			}
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "Cannot listen to the advertisements: %v\n", err)
+		}
+
+		wg.Wait()
+		return nil
+	},
+}
+
+// watchedLight is a light kept connected by yeego watch
+type watchedLight struct {
+	mu     sync.Mutex
+	light  *yeelight.Yeelight
+	state  string             // online or offline, empty before the first connection
+	cancel context.CancelFunc // closes the current connection
+	wake   chan struct{}      // reconnects without waiting
+}
+
+// run connects to the light until the context is cancelled, reconnecting when the connection is lost
+func (w *watchedLight) run(ctx context.Context) {
+	for {
+		w.mu.Lock()
+		light := *w.light
+		connCtx, cancel := context.WithCancel(ctx)
+		w.cancel = cancel
+		w.mu.Unlock()
+
+		err := light.GetProp()
+		if err == nil {
+			w.setState(eventOnline, &light, nil)
+			err = light.Listen(connCtx, func(n yeelight.Notification) {
+				if n.Method == "props" {
+					emit(event{Type: eventProps, ID: light.ID, Name: light.Name, Address: address(&light), Props: n.Params})
+				}
+			})
+		}
+
+		// the connection is closed on purpose when the light changes address
+		if ctx.Err() == nil && connCtx.Err() == nil {
+			w.setState(eventOffline, &light, err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-time.After(watchReconnect):
+		}
+	}
+}
+
+// setState prints the online and offline events when the reachability of the light changes
+func (w *watchedLight) setState(state string, light *yeelight.Yeelight, err error) {
+	w.mu.Lock()
+	changed := w.state != state
+	w.state = state
+	w.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	e := event{Type: state, ID: light.ID, Name: light.Name, Address: address(light)}
+	if state == eventOnline {
+		e.Props = map[string]string{
+			"power":  light.Power,
+			"bright": number(light.Bright),
+			"ct":     number(light.ColorTemp),
+			"rgb":    number(light.RGB),
+		}
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	emit(e)
+}
+
+// advertised handles an advertisement, the light may be back or have a new address
+func (w *watchedLight) advertised(ad yeelight.Yeelight) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sameID := ad.ID != "" && ad.ID == w.light.ID
+	if !sameID && ad.Location != w.light.Location {
+		return
+	}
+
+	if ad.Location != w.light.Location {
+		previous := address(w.light)
+		w.light.Location = ad.Location
+		emit(event{Type: eventAddress, ID: ad.ID, Name: w.light.Name, Address: address(&ad), Previous: previous})
+
+		// reconnect to the new address
+		if w.cancel != nil {
+			w.cancel()
+		}
+	} else if w.state == eventOnline {
+		return
+	}
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func address(light *yeelight.Yeelight) string {
+	return strings.Split(light.Location, ":")[0]
+}
+
+// emitMu keeps the events of the lights from being interleaved
+var emitMu sync.Mutex
+
+// emit prints an event as a line of text, or in the output format
+func emit(e event) {
+	emitMu.Lock()
+	defer emitMu.Unlock()
+
+	e.Time = time.Now()
+	switch outputFormat {
+	case "json":
+		data, _ := json.Marshal(e)
+		fmt.Printf("%s\n", data)
+	case "yaml":
+		fmt.Println("---")
+		writeYAML(os.Stdout, e)
+	case "template":
+		executeTemplate(e)
+	default:
+		fmt.Println(e.String())
+	}
+}
+
+func (e event) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %-13s  ", e.Time.Format("2006-01-02 15:04:05.000"), e.Type)
+
+	if e.Name != "" {
+		fmt.Fprintf(&b, "%s (%s)", e.Name, e.Address)
+	} else {
+		b.WriteString(e.Address)
+	}
+
+	if e.Previous != "" {
+		fmt.Fprintf(&b, " was %s", e.Previous)
+	}
+
+	for _, name := range sortedKeys(e.Props) {
+		if e.Props[name] != "" {
+			fmt.Fprintf(&b, " %s=%s", name, e.Props[name])
+		}
+	}
+
+	if e.Error != "" {
+		fmt.Fprintf(&b, ": %s", e.Error)
+	}
+
+	return b.String()
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchReconnect, "reconnect", 5*time.Second, "Time between two connections to an offline light")
+	rootCmd.AddCommand(watchCmd)
+}
@@ -1,10 +1,11 @@
 module github.com/julienrbrt/yeego
 
-go 1.18
+go 1.21
 
 require (
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0
 	github.com/spf13/cobra v1.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,171 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Frequency bands, in Hz
+const (
+	bassMax = 250
+	midMax  = 4000
+)
+
+// Features describe a window of audio.
+type Features struct {
+	RMS      float64 // loudness, between 0 and 1
+	Bass     float64 // energy of the bands, normalized by their recent maximum
+	Mid      float64
+	Treble   float64
+	Centroid float64 // spectral centroid in Hz, the "brightness" of the sound
+	Beat     bool    // a beat started in this window
+}
+
+// Analyzer computes the features of consecutive windows of audio.
+type Analyzer struct {
+	rate int
+
+	// recent maximum of each band, decaying, to normalize them
+	peaks [3]float64
+	// energy of the bass in the last second, for beat detection
+	history   []float64
+	sinceBeat int
+	minGap    int // minimum windows between two beats
+}
+
+// NewAnalyzer returns an analyzer for audio at the given sample rate, receiving
+// windows per second windows.
+func NewAnalyzer(rate int, windows float64) *Analyzer {
+	return &Analyzer{
+		rate:    rate,
+		history: make([]float64, 0, int(math.Max(1, windows))),
+		minGap:  int(math.Max(1, windows/8)),
+	}
+}
+
+// Analyze computes the features of a window of mono samples.
+func (a *Analyzer) Analyze(samples []float64) Features {
+	var f Features
+	if len(samples) == 0 {
+		return f
+	}
+
+	var sum float64
+	for _, s := range samples {
+		sum += s * s
+	}
+	f.RMS = math.Min(1, math.Sqrt(sum/float64(len(samples)))*math.Sqrt2)
+
+	spectrum := fft(window(samples))
+	binWidth := float64(a.rate) / float64(len(spectrum))
+
+	var bands [3]float64
+	var weighted, total float64
+	for i := 1; i < len(spectrum)/2; i++ {
+		freq := float64(i) * binWidth
+		energy := cmplx.Abs(spectrum[i])
+
+		switch {
+		case freq < bassMax:
+			bands[0] += energy
+		case freq < midMax:
+			bands[1] += energy
+		default:
+			bands[2] += energy
+		}
+
+		weighted += freq * energy
+		total += energy
+	}
+	if total > 0 {
+		f.Centroid = weighted / total
+	}
+
+	var normalized [3]float64
+	for i, energy := range bands {
+		a.peaks[i] = math.Max(energy, a.peaks[i]*0.995)
+		if a.peaks[i] > 0 {
+			normalized[i] = energy / a.peaks[i]
+		}
+	}
+	f.Bass, f.Mid, f.Treble = normalized[0], normalized[1], normalized[2]
+
+	f.Beat = a.beat(bands[0])
+	return f
+}
+
+// beat detects a bass energy well above its average over the last second
+func (a *Analyzer) beat(energy float64) bool {
+	var mean float64
+	for _, e := range a.history {
+		mean += e
+	}
+	if len(a.history) > 0 {
+		mean /= float64(len(a.history))
+	}
+
+	if len(a.history) == cap(a.history) {
+		copy(a.history, a.history[1:])
+		a.history = a.history[:len(a.history)-1]
+	}
+	a.history = append(a.history, energy)
+
+	a.sinceBeat++
+	// not above: silence, whose mean is 0, is not a beat
+	if len(a.history) < cap(a.history)/2 || energy <= 1.4*mean || a.sinceBeat < a.minGap {
+		return false
+	}
+
+	a.sinceBeat = 0
+	return true
+}
+
+// window applies a Hann window to the samples, padded with zeros to a power of two
+func window(samples []float64) []complex128 {
+	n := 1
+	for n < len(samples) {
+		n <<= 1
+	}
+
+	out := make([]complex128, n)
+	for i, s := range samples {
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(samples)))
+		out[i] = complex(s*w, 0)
+	}
+
+	return out
+}
+
+// fft computes the discrete Fourier transform of x, whose length is a power of two
+func fft(x []complex128) []complex128 {
+	n := len(x)
+	if n <= 1 {
+		return x
+	}
+
+	// bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+
+	return x
+}
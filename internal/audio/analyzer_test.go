@@ -0,0 +1,113 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	testRate = 16000
+	testFPS  = 20
+	testHop  = testRate / testFPS
+)
+
+// sine returns n samples of a sine wave at freq Hz
+func sine(freq, amplitude float64, n int) []float64 {
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = amplitude * math.Sin(2*math.Pi*freq*float64(i)/testRate)
+	}
+
+	return samples
+}
+
+func TestAnalyzeSine(t *testing.T) {
+	for _, test := range []struct {
+		freq, amplitude   float64
+		minCentroid       float64
+		maxCentroid       float64
+		bass, mid, treble bool // the band has energy
+	}{
+		{100, 0.5, 50, 250, true, false, false},
+		{1000, 1, 800, 1200, false, true, false},
+		{6000, 0.25, 5700, 6300, false, false, true},
+	} {
+		a := NewAnalyzer(testRate, testFPS)
+		f := a.Analyze(sine(test.freq, test.amplitude, testHop))
+
+		if math.Abs(f.RMS-test.amplitude) > 0.01 {
+			t.Errorf("%v Hz: RMS %v, want %v", test.freq, f.RMS, test.amplitude)
+		}
+		if f.Centroid < test.minCentroid || f.Centroid > test.maxCentroid {
+			t.Errorf("%v Hz: centroid %v, want between %v and %v", test.freq, f.Centroid, test.minCentroid, test.maxCentroid)
+		}
+
+		// the first window is its own maximum, the main band is at 1
+		for _, band := range []struct {
+			name   string
+			level  float64
+			energy bool
+		}{{"bass", f.Bass, test.bass}, {"mid", f.Mid, test.mid}, {"treble", f.Treble, test.treble}} {
+			if band.energy && band.level != 1 {
+				t.Errorf("%v Hz: %s %v, want 1", test.freq, band.name, band.level)
+			}
+		}
+		if f.Beat {
+			t.Errorf("%v Hz: beat in the first window", test.freq)
+		}
+	}
+}
+
+func TestAnalyzeNormalized(t *testing.T) {
+	a := NewAnalyzer(testRate, testFPS)
+	a.Analyze(sine(100, 1, testHop))
+
+	// a quieter sound is relative to the louder one before it
+	f := a.Analyze(sine(100, 0.5, testHop))
+	if f.Bass < 0.45 || f.Bass > 0.55 {
+		t.Errorf("got bass %v after a sound twice as loud, want 0.5", f.Bass)
+	}
+}
+
+func TestAnalyzeClickTrack(t *testing.T) {
+	a := NewAnalyzer(testRate, testFPS)
+
+	// a click of bass every half second, silence between them
+	var beats []int
+	for i := 0; i < 60; i++ {
+		samples := make([]float64, testHop)
+		if i%10 == 0 {
+			copy(samples[testHop/4:], sine(100, 0.8, testHop/2))
+		}
+
+		if a.Analyze(samples).Beat {
+			beats = append(beats, i)
+		}
+	}
+
+	// the first click comes before a history to compare it with
+	want := []int{10, 20, 30, 40, 50}
+	if len(beats) != len(want) {
+		t.Fatalf("got beats %v, want %v", beats, want)
+	}
+	for i := range want {
+		if beats[i] != want[i] {
+			t.Fatalf("got beats %v, want %v", beats, want)
+		}
+	}
+}
+
+func TestAnalyzeSilence(t *testing.T) {
+	a := NewAnalyzer(testRate, testFPS)
+	for i := 0; i < 60; i++ {
+		if f := a.Analyze(make([]float64, testHop)); f != (Features{}) {
+			t.Fatalf("window %d: got %+v for silence", i, f)
+		}
+	}
+}
+
+func TestAnalyzeEmpty(t *testing.T) {
+	if f := NewAnalyzer(testRate, testFPS).Analyze(nil); f != (Features{}) {
+		t.Errorf("got %+v for no samples", f)
+	}
+}
@@ -0,0 +1,132 @@
+// Package audio reads PCM audio and extracts the features driving audio-reactive lights.
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var errInvalidWAV = errors.New("Invalid WAV file")
+
+// Stream is signed 16-bit little endian PCM audio.
+type Stream struct {
+	Rate     int // samples per second
+	Channels int
+
+	r   io.Reader
+	buf []byte
+}
+
+// NewRawStream reads raw s16le PCM audio, as written by `ffmpeg -f s16le` or `parec`.
+func NewRawStream(r io.Reader, rate, channels int) (*Stream, error) {
+	if rate <= 0 || channels <= 0 {
+		return nil, errors.New("Sample rate and channels must be positive")
+	}
+
+	return &Stream{Rate: rate, Channels: channels, r: bufio.NewReader(r)}, nil
+}
+
+// NewWAVStream reads a 16-bit PCM WAV file, up to the end of its audio data.
+func NewWAVStream(r io.Reader) (*Stream, error) {
+	br := bufio.NewReader(r)
+
+	var header struct {
+		RIFF [4]byte
+		Size uint32
+		WAVE [4]byte
+	}
+	if err := binary.Read(br, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidWAV, err)
+	}
+	if string(header.RIFF[:]) != "RIFF" || string(header.WAVE[:]) != "WAVE" {
+		return nil, fmt.Errorf("%w: not a RIFF WAVE file", errInvalidWAV)
+	}
+
+	s := &Stream{r: br}
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(br, binary.LittleEndian, &chunk); err != nil {
+			return nil, fmt.Errorf("%w: no audio data: %w", errInvalidWAV, err)
+		}
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			var format struct {
+				AudioFormat   uint16
+				Channels      uint16
+				SampleRate    uint32
+				ByteRate      uint32
+				BlockAlign    uint16
+				BitsPerSample uint16
+			}
+			if chunk.Size < 16 {
+				return nil, fmt.Errorf("%w: format chunk too short", errInvalidWAV)
+			}
+			if err := binary.Read(br, binary.LittleEndian, &format); err != nil {
+				return nil, fmt.Errorf("%w: %w", errInvalidWAV, err)
+			}
+			if _, err := br.Discard(int(chunk.Size - 16 + chunk.Size%2)); err != nil {
+				return nil, fmt.Errorf("%w: %w", errInvalidWAV, err)
+			}
+
+			// 0xFFFE is WAVE_FORMAT_EXTENSIBLE, used for PCM too
+			if (format.AudioFormat != 1 && format.AudioFormat != 0xFFFE) || format.BitsPerSample != 16 {
+				return nil, fmt.Errorf("%w: only 16-bit PCM is supported", errInvalidWAV)
+			}
+			if format.Channels == 0 || format.SampleRate == 0 {
+				return nil, fmt.Errorf("%w: no channel or sample rate", errInvalidWAV)
+			}
+			s.Rate, s.Channels = int(format.SampleRate), int(format.Channels)
+		case "data":
+			if s.Rate == 0 {
+				return nil, fmt.Errorf("%w: audio data before its format", errInvalidWAV)
+			}
+			// the chunks after the audio, such as LIST or id3, are not read;
+			// files written to a pipe have no size, their audio runs to the end
+			if chunk.Size != 0 && chunk.Size != 0xFFFFFFFF {
+				s.r = io.LimitReader(br, int64(chunk.Size))
+			}
+			return s, nil
+		default:
+			// chunks are padded to an even size
+			if _, err := br.Discard(int(chunk.Size + chunk.Size%2)); err != nil {
+				return nil, fmt.Errorf("%w: %w", errInvalidWAV, err)
+			}
+		}
+	}
+}
+
+// Read fills samples with mono samples between -1 and 1, mixing the channels.
+// It returns io.EOF once the stream ended; the last samples read may be fewer than len(samples).
+func (s *Stream) Read(samples []float64) (int, error) {
+	frame := 2 * s.Channels
+	if need := len(samples) * frame; len(s.buf) < need {
+		s.buf = make([]byte, need)
+	}
+
+	n, err := io.ReadFull(s.r, s.buf[:len(samples)*frame])
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+
+	count := n / frame
+	for i := 0; i < count; i++ {
+		var sum float64
+		for c := 0; c < s.Channels; c++ {
+			sum += float64(int16(binary.LittleEndian.Uint16(s.buf[i*frame+2*c:])))
+		}
+		samples[i] = sum / float64(s.Channels) / 32768
+	}
+
+	if count == 0 && err == nil {
+		err = io.EOF
+	}
+
+	return count, err
+}
@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// wav builds a mono 16-bit WAV file with the samples, followed by the extra chunks
+func wav(samples []int16, extra ...[]byte) []byte {
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, samples)
+
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	body.WriteString("fmt ")
+	binary.Write(&body, binary.LittleEndian, []uint32{16})
+	binary.Write(&body, binary.LittleEndian, []uint16{1, 1})
+	binary.Write(&body, binary.LittleEndian, []uint32{8000, 16000})
+	binary.Write(&body, binary.LittleEndian, []uint16{2, 16})
+	body.WriteString("data")
+	binary.Write(&body, binary.LittleEndian, uint32(data.Len()))
+	body.Write(data.Bytes())
+	for _, chunk := range extra {
+		body.Write(chunk)
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+
+	return file.Bytes()
+}
+
+func TestWAVStreamStopsAtDataChunk(t *testing.T) {
+	list := append([]byte("LIST\x08\x00\x00\x00"), "INFOtest"...)
+	s, err := NewWAVStream(bytes.NewReader(wav([]int16{16384, -16384}, list)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Rate != 8000 || s.Channels != 1 {
+		t.Fatalf("got %d Hz and %d channels, want 8000 Hz and 1 channel", s.Rate, s.Channels)
+	}
+
+	samples := make([]float64, 8)
+	n, err := s.Read(samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || samples[0] != 0.5 || samples[1] != -0.5 {
+		t.Fatalf("got %v, want [0.5 -0.5]", samples[:n])
+	}
+
+	if _, err := s.Read(samples); !errors.Is(err, io.EOF) {
+		t.Fatalf("got %v after the audio data, want io.EOF", err)
+	}
+}
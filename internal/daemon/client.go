@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+// Client sends requests to the daemon. It is safe for concurrent use, the
+// requests are answered in any order.
+type Client struct {
+	conn net.Conn
+
+	mu      sync.Mutex
+	lastID  int64
+	pending map[int64]chan response
+	err     error // set once the connection is lost
+}
+
+// Dial connects to the daemon listening on the socket.
+func Dial(path string) (*Client, error) {
+	conn, err := net.DialTimeout("unix", path, 200*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	return newClient(conn), nil
+}
+
+// newClient sends the requests on the connection
+func newClient(conn net.Conn) *Client {
+	c := &Client{conn: conn, pending: make(map[int64]chan response)}
+	go c.read()
+
+	return c
+}
+
+// Close closes the connection to the daemon.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Call sends a request to the daemon and decodes its result into result.
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return ErrUnavailable
+	}
+	c.lastID++
+	id := c.lastID
+	done := make(chan response, 1)
+	c.pending[id] = done
+
+	req, _ := json.Marshal(request{JSONRPC: "2.0", ID: id, Method: method, Params: data})
+	_, err = c.conn.Write(append(req, '\n'))
+	if err != nil {
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	case resp := <-done:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+// read dispatches the responses to the pending requests until the connection is lost
+func (c *Client) read() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		done, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mu.Unlock()
+
+		if ok {
+			done <- resp
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.err = errConnectionLost
+	for id, done := range c.pending {
+		done <- response{ID: id, Error: &Error{Code: codeLight, Message: errConnectionLost.Error()}}
+		delete(c.pending, id)
+	}
+}
+
+// Middleware sends the commands to the daemon instead of the lights. The
+// commands which could not be sent to the daemon are sent to the lights.
+func (c *Client) Middleware() yeelight.Middleware {
+	return func(next yeelight.Handler) yeelight.Handler {
+		return func(ctx context.Context, ex *yeelight.Exchange) error {
+			start := time.Now()
+			defer func() { ex.Duration = time.Since(start) }()
+
+			var err error
+			ex.Request, err = json.Marshal(ex.Command)
+			if err != nil {
+				return err
+			}
+
+			params, err := json.Marshal(ex.Command.Params)
+			if err != nil {
+				return err
+			}
+
+			var result CallResult
+			err = c.Call(ctx, "light.call", CallParams{Location: ex.Light.Location, Method: ex.Command.Method, Params: params}, &result)
+			if errors.Is(err, ErrUnavailable) {
+				return next(ctx, ex)
+			}
+			if err != nil {
+				return err
+			}
+
+			result.Response.ID = ex.Command.ID
+			ex.Response = result.Response
+			ex.Reply, _ = json.Marshal(result.Response)
+			if ex.Response.Error.Code != 0 {
+				return ex.Response.Error
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+// direct answers the commands which reached the lights, instead of the daemon
+func direct(sent *[]string) yeelight.Middleware {
+	return func(next yeelight.Handler) yeelight.Handler {
+		return func(ctx context.Context, ex *yeelight.Exchange) error {
+			*sent = append(*sent, ex.Command.Method)
+			ex.Response = yeelight.Response{ID: ex.Command.ID, Result: []interface{}{"ok"}}
+			return nil
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls []CallParams
+	c := pipe(t, map[string]handlerFunc{
+		"light.call": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			var p CallParams
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, err
+			}
+			calls = append(calls, p)
+			return CallResult{Response: yeelight.Response{Result: []interface{}{"on"}}}, nil
+		},
+	})
+
+	var sent []string
+	light := yeelight.NewClient(yeelight.WithMiddleware(c.Middleware(), direct(&sent))).
+		Bind(&yeelight.Yeelight{Location: "127.0.0.1:55443"})
+
+	resp, err := light.Call(context.Background(), "get_prop", "power")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := resp.Strings(); len(values) != 1 || values[0] != "on" {
+		t.Fatalf("got %v, want [on]", resp.Result)
+	}
+
+	if len(sent) != 0 {
+		t.Fatalf("%v sent to the light", sent)
+	}
+	if len(calls) != 1 || calls[0].Location != "127.0.0.1:55443" || calls[0].Method != "get_prop" || string(calls[0].Params) != `["power"]` {
+		t.Fatalf("got %+v sent to the daemon", calls)
+	}
+}
+
+func TestMiddlewareFallback(t *testing.T) {
+	// a daemon which went away
+	c := pipe(t, nil)
+	c.Close()
+
+	var sent []string
+	light := yeelight.NewClient(yeelight.WithMiddleware(c.Middleware(), direct(&sent))).
+		Bind(&yeelight.Yeelight{Location: "127.0.0.1:55443"})
+
+	if _, err := light.Call(context.Background(), "set_power", "on"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0] != "set_power" {
+		t.Fatalf("got %v sent to the light, want [set_power]", sent)
+	}
+}
@@ -0,0 +1,96 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+// CallParams is a command sent to a light through the daemon.
+type CallParams struct {
+	Location string          `json:"location"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params"`
+}
+
+// CallResult is the answer of the light, Cached is set when the daemon answered
+// from the state it keeps.
+type CallResult struct {
+	Response yeelight.Response `json:"response"`
+	Cached   bool              `json:"cached"`
+}
+
+// Serve answers the clients connecting to the listener with the lights of the
+// registry, until the context is cancelled or a client stops the daemon.
+func Serve(ctx context.Context, ln net.Listener, r *Registry) error {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	stopListener := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stopListener()
+
+	handlers := map[string]handlerFunc{
+		"light.call": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			return call(ctx, r, params)
+		},
+		"light.list": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			return r.Lights(), nil
+		},
+		"daemon.stop": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			stop()
+			return true, nil
+		},
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(ctx, conn, handlers)
+		}()
+	}
+}
+
+// call sends the command of a client to the light
+func call(ctx context.Context, r *Registry, data json.RawMessage) (interface{}, error) {
+	var p CallParams
+	if err := json.Unmarshal(data, &p); err != nil || p.Location == "" || p.Method == "" {
+		return nil, &Error{Code: codeInvalidParams, Message: "Location and method are mandatory"}
+	}
+
+	// keep the numbers as written by the client
+	var params []interface{}
+	if len(p.Params) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(p.Params))
+		decoder.UseNumber()
+		if err := decoder.Decode(&params); err != nil {
+			return nil, &Error{Code: codeInvalidParams, Message: "Params must be a list"}
+		}
+	}
+
+	resp, cached, err := r.Call(ctx, p.Location, p.Method, params...)
+
+	// the errors of the light are part of the response
+	var lightErr yeelight.Error
+	if err != nil && !errors.As(err, &lightErr) {
+		return nil, err
+	}
+
+	return CallResult{Response: resp, Cached: cached}, nil
+}
@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// idleTimeout is how long an unused connection is kept open to a light
+const idleTimeout = time.Minute
+
+// Pool is a yeelight.Dialer keeping the connections to the lights open between
+// the requests. A connection is reused once the request which opened it
+// succeeded, the failed ones are closed.
+type Pool struct {
+	dialer net.Dialer
+
+	mu   sync.Mutex
+	idle map[string]*pooledConn
+}
+
+// NewPool returns an empty pool of connections.
+func NewPool() *Pool {
+	return &Pool{idle: make(map[string]*pooledConn)}
+}
+
+// DialContext returns the idle connection to the address, or opens a new one.
+func (p *Pool) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	p.mu.Lock()
+	conn, ok := p.idle[address]
+	delete(p.idle, address)
+	p.mu.Unlock()
+
+	if ok && time.Since(conn.released) < idleTimeout {
+		conn.broken = false
+		return conn, nil
+	}
+	if ok {
+		conn.Conn.Close()
+	}
+
+	c, err := p.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pooledConn{Conn: c, pool: p, address: address}, nil
+}
+
+// Close closes the idle connections.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for address, conn := range p.idle {
+		conn.Conn.Close()
+		delete(p.idle, address)
+	}
+
+	return nil
+}
+
+// release keeps the connection for the next request, a light accepts few connections
+// so a single one is kept by address
+func (p *Pool) release(conn *pooledConn) {
+	conn.SetDeadline(time.Time{})
+	conn.released = time.Now()
+
+	p.mu.Lock()
+	previous, ok := p.idle[conn.address]
+	p.idle[conn.address] = conn
+	p.mu.Unlock()
+
+	if ok {
+		previous.Conn.Close()
+	}
+}
+
+// pooledConn goes back to the pool when closed, unless a read or a write failed
+type pooledConn struct {
+	net.Conn
+	pool     *Pool
+	address  string
+	broken   bool
+	released time.Time
+}
+
+func (c *pooledConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.broken = true
+	}
+
+	return n, err
+}
+
+func (c *pooledConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if err != nil {
+		c.broken = true
+	}
+
+	return n, err
+}
+
+func (c *pooledConn) Close() error {
+	if c.broken {
+		return c.Conn.Close()
+	}
+
+	c.pool.release(c)
+	return nil
+}
@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+// accepting counts the connections accepted by a local listener
+func accepting(t *testing.T) (string, <-chan net.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	conns := make(chan net.Conn, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	return ln.Addr().String(), conns
+}
+
+func TestPoolReuse(t *testing.T) {
+	address, accepted := accepting(t)
+	p := NewPool()
+	defer p.Close()
+
+	first, err := p.DialContext(context.Background(), "tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := <-accepted
+	first.Close()
+
+	second, err := p.DialContext(context.Background(), "tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Fatal("the idle connection was not reused")
+	}
+
+	// a connection which failed is not kept
+	server.Close()
+	second.Read(make([]byte, 1))
+	second.Close()
+
+	third, err := p.DialContext(context.Background(), "tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if third == second {
+		t.Fatal("the broken connection was reused")
+	}
+	<-accepted
+}
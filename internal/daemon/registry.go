@@ -0,0 +1,309 @@
+package daemon
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+// cachedProps are the properties get_prop reads from the cache while the light is connected
+var cachedProps = map[string]func(y yeelight.Yeelight) string{
+	"power":      func(y yeelight.Yeelight) string { return y.Power },
+	"bright":     func(y yeelight.Yeelight) string { return strconv.Itoa(y.Bright) },
+	"ct":         func(y yeelight.Yeelight) string { return strconv.Itoa(y.ColorTemp) },
+	"rgb":        func(y yeelight.Yeelight) string { return strconv.Itoa(y.RGB) },
+	"hue":        func(y yeelight.Yeelight) string { return strconv.Itoa(y.Hue) },
+	"sat":        func(y yeelight.Yeelight) string { return strconv.Itoa(y.Saturation) },
+	"color_mode": func(y yeelight.Yeelight) string { return strconv.Itoa(y.ColorMode) },
+	"name":       func(y yeelight.Yeelight) string { return y.Name },
+}
+
+// LightStatus is a light of the registry.
+type LightStatus struct {
+	Light     yeelight.Yeelight `json:"light"`
+	Connected bool              `json:"connected"`
+	Updated   time.Time         `json:"updated"`
+}
+
+// Registry keeps a connection open to each light to cache its state, and sends
+// the commands through its yeelight.Client. Lights are added when they
+// advertise themselves or when a command is sent to them.
+type Registry struct {
+	client    *yeelight.Client
+	listener  *yeelight.Client // the connections kept open do not go through the client
+	reconnect time.Duration
+
+	mu          sync.Mutex
+	ctx         context.Context   // set by Run
+	lights      map[string]*entry // by location
+	subscribers map[chan LightStatus]struct{}
+}
+
+// entry is a light of the registry
+type entry struct {
+	live   *yeelight.LiveLight
+	cancel context.CancelFunc
+	wake   chan struct{}
+
+	mu        sync.Mutex
+	connected bool
+	checked   bool // the light was reached or not at least once
+}
+
+// NewRegistry returns a registry sending the commands with the client, starting
+// from the given lights. Lost connections are reopened after reconnect.
+func NewRegistry(client *yeelight.Client, lights []yeelight.Yeelight, reconnect time.Duration) *Registry {
+	r := &Registry{
+		client:      client,
+		listener:    yeelight.NewClient(),
+		reconnect:   reconnect,
+		lights:      make(map[string]*entry),
+		subscribers: make(map[chan LightStatus]struct{}),
+	}
+	for _, light := range lights {
+		r.lights[light.Location] = r.newEntry(light)
+	}
+
+	return r
+}
+
+func (r *Registry) newEntry(light yeelight.Yeelight) *entry {
+	return &entry{live: yeelight.NewLiveLight(*r.client.Bind(&light)), wake: make(chan struct{}, 1)}
+}
+
+// Run keeps the lights connected and follows their advertisements until the
+// context is cancelled.
+func (r *Registry) Run(ctx context.Context) error {
+	r.mu.Lock()
+	r.ctx = ctx
+	for _, e := range r.lights {
+		r.start(e)
+	}
+	r.mu.Unlock()
+
+	// without multicast, the lights are still kept connected
+	r.client.Advertisements(ctx, r.advertised)
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// Lights returns the lights of the registry, sorted by location.
+func (r *Registry) Lights() []LightStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lights := make([]LightStatus, 0, len(r.lights))
+	for _, e := range r.lights {
+		lights = append(lights, e.status())
+	}
+
+	sort.Slice(lights, func(i, j int) bool { return lights[i].Light.Location < lights[j].Light.Location })
+	return lights
+}
+
+// Status returns the light at location, if it is in the registry.
+func (r *Registry) Status(location string) (LightStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.lights[location]
+	if !ok {
+		return LightStatus{}, false
+	}
+
+	return e.status(), true
+}
+
+// Light returns the light at location, its commands update the cached state.
+func (r *Registry) Light(location string) *yeelight.Yeelight {
+	return r.entry(location).live.Light()
+}
+
+// Call sends a method to the light at location, get_prop is answered from the
+// cache while the light is connected.
+func (r *Registry) Call(ctx context.Context, location, method string, params ...interface{}) (yeelight.Response, bool, error) {
+	e := r.entry(location)
+	if resp, ok := e.cached(method, params); ok {
+		return resp, true, nil
+	}
+
+	resp, err := e.live.Call(ctx, method, params...)
+	return resp, false, err
+}
+
+// Subscribe returns the changes of the lights: their state, and whether they are
+// connected. Changes are dropped while the channel is full. The channel is
+// closed once the context is cancelled.
+func (r *Registry) Subscribe(ctx context.Context) <-chan LightStatus {
+	ch := make(chan LightStatus, 64)
+
+	r.mu.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mu.Unlock()
+
+	context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.subscribers, ch)
+		close(ch)
+	})
+
+	return ch
+}
+
+// publish sends the status of the light to the subscribers
+func (r *Registry) publish(e *entry) {
+	status := e.status()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ch := range r.subscribers {
+		select {
+		case ch <- status:
+		default:
+		}
+	}
+}
+
+// entry returns the light at location, adding it to the registry if unknown
+func (r *Registry) entry(location string) *entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.lights[location]
+	if !ok {
+		e = r.newEntry(yeelight.Yeelight{Location: location})
+		r.lights[location] = e
+		r.start(e)
+	}
+
+	return e
+}
+
+// start keeps the light connected, r.mu must be held
+func (r *Registry) start(e *entry) {
+	if r.ctx == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.ctx)
+	e.cancel = cancel
+	go r.run(ctx, e)
+}
+
+// advertised adds the new lights to the registry and follows the lights changing address
+func (r *Registry) advertised(ad yeelight.Yeelight) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.lights[ad.Location]; ok {
+		e.reconnect()
+		return
+	}
+
+	for location, e := range r.lights {
+		state, _ := e.live.State()
+		if ad.ID == "" || state.ID != ad.ID {
+			continue
+		}
+
+		// the light came back with another address
+		e.cancel()
+		delete(r.lights, location)
+		state.Location = ad.Location
+		ad = state
+		break
+	}
+
+	e := r.newEntry(ad)
+	r.lights[ad.Location] = e
+	r.start(e)
+}
+
+// run refreshes the state of the light, then follows its notifications until
+// the connection is lost, and starts again
+func (r *Registry) run(ctx context.Context, e *entry) {
+	for {
+		err := e.live.Refresh(ctx)
+		if err == nil {
+			r.setConnected(e, true)
+			r.listener.Bind(e.live.Light()).Listen(ctx, func(n yeelight.Notification) {
+				if n.Method == "props" {
+					e.live.Update(n.Params)
+					r.publish(e)
+				}
+			})
+		}
+		if ctx.Err() == nil {
+			r.setConnected(e, false)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.wake:
+		case <-time.After(r.reconnect):
+		}
+	}
+}
+
+// setConnected publishes the light when it is reached, or when it is lost
+func (r *Registry) setConnected(e *entry, connected bool) {
+	e.mu.Lock()
+	changed := !e.checked || e.connected != connected
+	e.connected, e.checked = connected, true
+	e.mu.Unlock()
+
+	if changed || connected {
+		r.publish(e)
+	}
+}
+
+func (e *entry) status() LightStatus {
+	state, updated := e.live.State()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return LightStatus{Light: state, Connected: e.connected, Updated: updated}
+}
+
+// reconnect wakes up a light waiting to reconnect
+func (e *entry) reconnect() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cached answers get_prop from the state of a connected light, the state is kept
+// current by its notifications
+func (e *entry) cached(method string, params []interface{}) (yeelight.Response, bool) {
+	e.mu.Lock()
+	connected := e.connected
+	e.mu.Unlock()
+
+	if method != "get_prop" || !connected {
+		return yeelight.Response{}, false
+	}
+
+	state, _ := e.live.State()
+	values := make([]interface{}, len(params))
+	for i, param := range params {
+		name, _ := param.(string)
+		prop, ok := cachedProps[name]
+		if !ok {
+			return yeelight.Response{}, false
+		}
+		values[i] = prop(state)
+	}
+
+	return yeelight.Response{Result: values}, true
+}
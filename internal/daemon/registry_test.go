@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/julienrbrt/yeego/light/yeelight"
+)
+
+func TestRegistryCachedGetProp(t *testing.T) {
+	var sent []string
+	location := "127.0.0.1:55443"
+	r := NewRegistry(yeelight.NewClient(yeelight.WithMiddleware(direct(&sent))), []yeelight.Yeelight{{Location: location}}, 0)
+
+	// the light is not kept connected without Run, as if it was reached once
+	e := r.entry(location)
+	e.live.Update(map[string]string{"power": "on", "bright": "42"})
+	r.setConnected(e, true)
+
+	resp, cached, err := r.Call(context.Background(), location, "get_prop", "power", "bright")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"on", "42"}; !cached || !reflect.DeepEqual(resp.Result, want) {
+		t.Fatalf("got %v, cached %t, want %v from the cache", resp.Result, cached, want)
+	}
+
+	// the properties missing from the cache are read from the light
+	if _, cached, _ := r.Call(context.Background(), location, "get_prop", "power", "flowing"); cached {
+		t.Fatal("flowing answered from the cache")
+	}
+
+	r.setConnected(e, false)
+	if _, cached, _ := r.Call(context.Background(), location, "get_prop", "power"); cached {
+		t.Fatal("disconnected light answered from the cache")
+	}
+
+	if want := []string{"get_prop", "get_prop"}; !reflect.DeepEqual(sent, want) {
+		t.Fatalf("got %v sent to the light, want %v", sent, want)
+	}
+}
@@ -0,0 +1,137 @@
+// Package daemon keeps the lights connected in a long running process and
+// serves them to the CLI with JSON-RPC 2.0 on a Unix socket.
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// ErrUnavailable is returned when a request could not be sent to the daemon.
+// The request did not reach the daemon and can be sent to the lights directly.
+var ErrUnavailable = errors.New("Daemon unavailable")
+
+// errConnectionLost is returned for the requests sent before the daemon went away
+var errConnectionLost = errors.New("Connection to the daemon lost")
+
+// JSON-RPC error codes
+const (
+	codeParse          = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeLight          = -32000 // the light could not be reached
+)
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error returned by the daemon.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// SocketPath returns the socket of the daemon: YEEGO_SOCKET, or yeego.sock in
+// XDG_RUNTIME_DIR, or a socket of the user in the temporary directory.
+func SocketPath() string {
+	if p := os.Getenv("YEEGO_SOCKET"); p != "" {
+		return p
+	}
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "yeego.sock")
+	}
+
+	return filepath.Join(os.TempDir(), "yeego-"+strconv.Itoa(os.Getuid())+".sock")
+}
+
+// handlerFunc answers a request, errors which are not an *Error are reported as light errors
+type handlerFunc func(ctx context.Context, params json.RawMessage) (interface{}, error)
+
+// serve answers the requests of a connection until it is closed
+func serve(ctx context.Context, conn net.Conn, handlers map[string]handlerFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var (
+		mu sync.Mutex // one response written at a time
+		wg sync.WaitGroup
+	)
+	write := func(resp response) {
+		resp.JSONRPC = "2.0"
+		data, _ := json.Marshal(resp)
+
+		mu.Lock()
+		defer mu.Unlock()
+		conn.Write(append(data, '\n'))
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			write(response{Error: &Error{Code: codeParse, Message: err.Error()}})
+			continue
+		}
+
+		handler, ok := handlers[req.Method]
+		if !ok {
+			write(response{ID: req.ID, Error: &Error{Code: codeMethodNotFound, Message: "Unknown method " + req.Method}})
+			continue
+		}
+
+		// a slow light does not hold the other requests
+		wg.Add(1)
+		go func(req request) {
+			defer wg.Done()
+
+			result, err := handler(ctx, req.Params)
+			if err != nil {
+				var rpcErr *Error
+				if !errors.As(err, &rpcErr) {
+					rpcErr = &Error{Code: codeLight, Message: err.Error()}
+				}
+				write(response{ID: req.ID, Error: rpcErr})
+				return
+			}
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				write(response{ID: req.ID, Error: &Error{Code: codeLight, Message: err.Error()}})
+				return
+			}
+			write(response{ID: req.ID, Result: data})
+		}(req)
+	}
+
+	// the requests are cancelled with the connection
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipe serves the handlers on one end of a pipe, and returns a client of the other end
+func pipe(t *testing.T, handlers map[string]handlerFunc) *Client {
+	t.Helper()
+
+	server, conn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve(ctx, server, handlers)
+	}()
+
+	c := newClient(conn)
+	t.Cleanup(func() {
+		c.Close()
+		cancel()
+		<-done
+	})
+
+	return c
+}
+
+func TestServeFraming(t *testing.T) {
+	server, conn := net.Pipe()
+	defer conn.Close()
+
+	echo := func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+		return params, nil
+	}
+	go serve(context.Background(), server, map[string]handlerFunc{"echo": echo})
+
+	// two requests in a single write, and a line which is not JSON
+	go conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"echo","params":[1]}` + "\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"unknown"}` + "\n" + "{\n"))
+
+	codes := make(map[int64]int)
+	scanner := bufio.NewScanner(conn)
+	for i := 0; i < 3 && scanner.Scan(); i++ {
+		var resp response
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.JSONRPC != "2.0" {
+			t.Fatalf("got version %q, want 2.0", resp.JSONRPC)
+		}
+
+		switch {
+		case resp.Error != nil:
+			codes[resp.ID] = resp.Error.Code
+		case resp.ID != 1 || string(resp.Result) != "[1]":
+			t.Fatalf("got result %s for %d, want [1] for 1", resp.Result, resp.ID)
+		}
+	}
+
+	if codes[2] != codeMethodNotFound || codes[0] != codeParse {
+		t.Fatalf("got error codes %v, want %d for 2 and %d for 0", codes, codeMethodNotFound, codeParse)
+	}
+}
+
+func TestClientOutOfOrder(t *testing.T) {
+	release := make(chan struct{})
+	c := pipe(t, map[string]handlerFunc{
+		"slow": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			<-release
+			return "slow", nil
+		},
+		"fast": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			return "fast", nil
+		},
+	})
+
+	slow := make(chan string, 1)
+	go func() {
+		var result string
+		if err := c.Call(context.Background(), "slow", nil, &result); err != nil {
+			t.Error(err)
+		}
+		slow <- result
+	}()
+
+	// the fast request is answered while the slow one is pending
+	var result string
+	if err := c.Call(context.Background(), "fast", nil, &result); err != nil || result != "fast" {
+		t.Fatalf("got %q and %v, want fast", result, err)
+	}
+
+	close(release)
+	if result := <-slow; result != "slow" {
+		t.Fatalf("got %q, want slow", result)
+	}
+}
+
+func TestClientConnectionLost(t *testing.T) {
+	server, conn := net.Pipe()
+	c := newClient(conn)
+	defer c.Close()
+
+	// the daemon goes away with a request pending
+	go func() {
+		bufio.NewReader(server).ReadBytes('\n')
+		server.Close()
+	}()
+
+	err := c.Call(context.Background(), "light.list", nil, nil)
+	if err == nil || err.Error() != errConnectionLost.Error() {
+		t.Fatalf("pending request: got %v, want %v", err, errConnectionLost)
+	}
+
+	if err := c.Call(context.Background(), "light.list", nil, nil); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("request after the loss: got %v, want ErrUnavailable", err)
+	}
+}
+
+func TestClientCancelled(t *testing.T) {
+	c := pipe(t, map[string]handlerFunc{
+		"block": func(ctx context.Context, params json.RawMessage) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := c.Call(ctx, "block", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
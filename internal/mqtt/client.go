@@ -0,0 +1,343 @@
+// Package mqtt is a minimal MQTT 3.1.1 client: it publishes and receives
+// messages at QoS 0, with a last will and keep alive.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrConnectionLost is returned once the connection to the broker is lost.
+var ErrConnectionLost = errors.New("Connection to the MQTT broker lost")
+
+// Message is a message published on a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options are the options of the connection to the broker.
+type Options struct {
+	ClientID string
+	Username string // the user of the broker URL by default
+	Password string
+
+	// KeepAlive is the longest time without packets sent to the broker,
+	// after which the broker considers the client gone and publishes its will.
+	KeepAlive time.Duration
+
+	// Will is published by the broker when the connection is lost.
+	Will *Message
+
+	// Handler is called for every message received, in the order received. It
+	// runs apart from the reads, a slow handler does not hold the keep alive.
+	Handler func(Message)
+}
+
+// Client is a connection to a broker. It is safe for concurrent use.
+type Client struct {
+	conn    net.Conn
+	handler func(Message)
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	lastID   uint16
+	pending  map[uint16]chan []byte // SUBACK return codes by packet identifier
+	received []Message              // waiting for the handler
+	ready    chan struct{}
+	err      error
+	done     chan struct{}
+}
+
+// Dial connects to the broker at the URL, tcp://host:port or mqtt://host:port,
+// or ssl://, tls:// or mqtts:// for TLS.
+func Dial(ctx context.Context, broker string, opts Options) (*Client, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid broker URL %q, must be like tcp://localhost:1883", broker)
+	}
+
+	var secure bool
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		secure = true
+	default:
+		return nil, fmt.Errorf("Unsupported broker scheme %q, must be tcp, mqtt, ssl, tls or mqtts", u.Scheme)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if secure {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	if opts.Username == "" && u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if secure {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	return connect(ctx, conn, opts)
+}
+
+// connect sends CONNECT on the connection to the broker, and starts the client once accepted
+func connect(ctx context.Context, conn net.Conn, opts Options) (*Client, error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	if _, err := conn.Write(connectPacket(opts).encode()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ack, err := readPacket(reader)
+	if err == nil {
+		err = checkConnack(ack)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		conn:    conn,
+		handler: opts.Handler,
+		pending: make(map[uint16]chan []byte),
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go c.read(reader, opts.KeepAlive)
+	go c.ping(opts.KeepAlive)
+	go c.dispatch()
+
+	return c, nil
+}
+
+// Publish sends a message to the broker, at QoS 0.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	p, err := publishPacket(Message{Topic: topic, Payload: payload, Retain: retain})
+	if err != nil {
+		return err
+	}
+
+	return c.write(p)
+}
+
+// Subscribe subscribes to the topic filters, the messages received are passed
+// to the handler of the options.
+func (c *Client) Subscribe(ctx context.Context, filters ...string) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.lastID++
+	if c.lastID == 0 {
+		c.lastID = 1
+	}
+	id := c.lastID
+	ack := make(chan []byte, 1)
+	c.pending[id] = ack
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(subscribePacket(id, filters)); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return c.Err()
+	case codes := <-ack:
+		for i, code := range codes {
+			if code == 0x80 && i < len(filters) {
+				return fmt.Errorf("Subscription to %s refused by the broker", filters[i])
+			}
+		}
+		return nil
+	}
+}
+
+// Done is closed once the connection is lost or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection was lost, once Done is closed.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// Close disconnects from the broker, the will is not published.
+func (c *Client) Close() error {
+	c.write(packet{kind: typeDisconnect})
+	c.fail(net.ErrClosed)
+
+	return nil
+}
+
+// write sends a packet, writes of concurrent goroutines are not interleaved
+func (c *Client) write(p packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	if _, err := c.conn.Write(p.encode()); err != nil {
+		c.fail(err)
+		return c.Err()
+	}
+
+	return nil
+}
+
+// read dispatches the packets of the broker until the connection is lost. The
+// broker answers the pings, so the connection is lost after keepAlive without packets.
+func (c *Client) read(reader *bufio.Reader, keepAlive time.Duration) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(keepAlive * 3 / 2))
+		p, err := readPacket(reader)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		switch p.kind {
+		case typePublish:
+			m, id, err := decodePublish(p)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			if (p.flags>>1)&0x03 == 1 {
+				c.write(packet{kind: typePuback, body: binary.BigEndian.AppendUint16(nil, id)})
+			}
+			c.receive(m)
+		case typeSuback:
+			if len(p.body) < 2 {
+				c.fail(errMalformed)
+				return
+			}
+			id := binary.BigEndian.Uint16(p.body)
+			c.mu.Lock()
+			if ack, ok := c.pending[id]; ok {
+				ack <- p.body[2:]
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// receive queues a message for the handler
+func (c *Client) receive(m Message) {
+	if c.handler == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.received = append(c.received, m)
+	c.mu.Unlock()
+
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch passes the messages received to the handler, in order, until the connection is lost
+func (c *Client) dispatch() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.ready:
+		}
+
+		for {
+			c.mu.Lock()
+			if len(c.received) == 0 {
+				c.mu.Unlock()
+				break
+			}
+			m := c.received[0]
+			c.received = c.received[1:]
+			c.mu.Unlock()
+
+			c.handler(m)
+		}
+	}
+}
+
+// ping keeps the connection alive
+func (c *Client) ping(keepAlive time.Duration) {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packet{kind: typePingreq})
+		}
+	}
+}
+
+// fail closes the connection once, err is returned to the pending and later calls
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	if !errors.Is(err, net.ErrClosed) {
+		err = fmt.Errorf("%w: %w", ErrConnectionLost, err)
+	}
+	c.err = err
+	c.conn.Close()
+	close(c.done)
+}
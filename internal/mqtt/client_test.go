@@ -0,0 +1,206 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// broker is the side of a pipe read by the tests
+type broker struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (b *broker) expect(kind byte) packet {
+	b.t.Helper()
+
+	b.conn.SetReadDeadline(time.Now().Add(time.Second))
+	p, err := readPacket(b.reader)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	if p.kind != kind {
+		b.t.Fatalf("got packet %d, want %d", p.kind, kind)
+	}
+
+	return p
+}
+
+func (b *broker) send(p packet) {
+	b.t.Helper()
+
+	if _, err := b.conn.Write(p.encode()); err != nil {
+		b.t.Fatal(err)
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	b := &broker{t: t, conn: server, reader: bufio.NewReader(server)}
+
+	received := make(chan Message, 1)
+	opts := Options{
+		ClientID:  "yeego-test",
+		Username:  "user",
+		Password:  "secret",
+		KeepAlive: time.Minute,
+		Will:      &Message{Topic: "yeego/status", Payload: []byte("offline"), Retain: true},
+		Handler:   func(m Message) { received <- m },
+	}
+
+	connected := make(chan error, 1)
+	var c *Client
+	go func() {
+		var err error
+		c, err = connect(context.Background(), conn, opts)
+		connected <- err
+	}()
+
+	p := b.expect(typeConnect)
+	protocol, rest, _ := readString(p.body)
+	if protocol != "MQTT" || rest[0] != 4 {
+		t.Fatalf("got protocol %s level %d, want MQTT 4", protocol, rest[0])
+	}
+	if flags := rest[1]; flags != flagCleanSession|flagWill|flagWillRetain|flagUsername|flagPassword {
+		t.Fatalf("got connect flags %08b", flags)
+	}
+	if keepAlive := binary.BigEndian.Uint16(rest[2:]); keepAlive != 60 {
+		t.Fatalf("got keep alive %d, want 60", keepAlive)
+	}
+	var fields []string
+	for rest = rest[4:]; len(rest) > 0; {
+		var field string
+		var err error
+		if field, rest, err = readString(rest); err != nil {
+			t.Fatal(err)
+		}
+		fields = append(fields, field)
+	}
+	if want := []string{"yeego-test", "yeego/status", "offline", "user", "secret"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("got payload %q, want %q", fields, want)
+	}
+
+	b.send(packet{kind: typeConnack, body: []byte{0, 0}})
+	if err := <-connected; err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- c.Subscribe(context.Background(), "yeego/+/set") }()
+
+	p = b.expect(typeSubscribe)
+	if p.flags != 0x02 {
+		t.Fatalf("got SUBSCRIBE flags %d, want 2", p.flags)
+	}
+	id := binary.BigEndian.Uint16(p.body)
+	filter, rest, _ := readString(p.body[2:])
+	if filter != "yeego/+/set" || len(rest) != 1 || rest[0] != 0 {
+		t.Fatalf("got filter %s with QoS %v", filter, rest)
+	}
+	b.send(packet{kind: typeSuback, body: append(binary.BigEndian.AppendUint16(nil, id), 0)})
+	if err := <-subscribed; err != nil {
+		t.Fatal(err)
+	}
+
+	// a message of QoS 1 is acknowledged
+	body := appendString(nil, "yeego/desk/set")
+	body = binary.BigEndian.AppendUint16(body, 7)
+	b.send(packet{kind: typePublish, flags: 0x02, body: append(body, "ON"...)})
+	if p := b.expect(typePuback); binary.BigEndian.Uint16(p.body) != 7 {
+		t.Fatalf("got PUBACK of %d, want 7", binary.BigEndian.Uint16(p.body))
+	}
+	if m := <-received; m.Topic != "yeego/desk/set" || string(m.Payload) != "ON" {
+		t.Fatalf("got %s %s", m.Topic, m.Payload)
+	}
+
+	go c.Publish("yeego/desk", []byte(`{"state":"ON"}`), true)
+	m, _, err := decodePublish(b.expect(typePublish))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Topic != "yeego/desk" || string(m.Payload) != `{"state":"ON"}` || !m.Retain {
+		t.Fatalf("got %s %s retained %t", m.Topic, m.Payload, m.Retain)
+	}
+
+	go c.Close()
+	b.expect(typeDisconnect)
+	<-c.Done()
+}
+
+func TestClientRefused(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	b := &broker{t: t, conn: server, reader: bufio.NewReader(server)}
+
+	go func() {
+		if _, err := readPacket(b.reader); err == nil {
+			server.Write(packet{kind: typeConnack, body: []byte{0, 5}}.encode())
+		}
+	}()
+
+	_, err := connect(context.Background(), conn, Options{ClientID: "yeego-test", KeepAlive: time.Minute})
+	if err == nil || err.Error() != "Connection refused by the broker: not authorized" {
+		t.Fatalf("got %v, want the connection refused", err)
+	}
+}
+
+func TestClientSlowHandler(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	b := &broker{t: t, conn: server, reader: bufio.NewReader(server)}
+
+	release := make(chan struct{})
+	handled := make(chan string, 2)
+	opts := Options{ClientID: "yeego-test", KeepAlive: time.Minute, Handler: func(m Message) {
+		<-release
+		handled <- string(m.Payload)
+	}}
+
+	connected := make(chan *Client, 1)
+	go func() {
+		c, err := connect(context.Background(), conn, opts)
+		if err != nil {
+			t.Error(err)
+		}
+		connected <- c
+	}()
+	b.expect(typeConnect)
+	b.send(packet{kind: typeConnack, body: []byte{0, 0}})
+	c := <-connected
+	if c == nil {
+		t.FailNow()
+	}
+	defer func() { go c.Close() }()
+
+	b.send(packet{kind: typePublish, body: append(appendString(nil, "yeego/desk/set"), "first"...)})
+	b.send(packet{kind: typePublish, body: append(appendString(nil, "yeego/desk/set"), "second"...)})
+
+	// the broker is still read while the handler is busy
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- c.Subscribe(context.Background(), "yeego/+/set") }()
+	id := binary.BigEndian.Uint16(b.expect(typeSubscribe).body)
+	b.send(packet{kind: typeSuback, body: append(binary.BigEndian.AppendUint16(nil, id), 0)})
+	select {
+	case err := <-subscribed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SUBACK not read while the handler is busy")
+	}
+
+	close(release)
+	for _, want := range []string{"first", "second"} {
+		if got := <-handled; got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	}
+}
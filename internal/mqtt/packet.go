@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// packet types
+const (
+	typeConnect    = 1
+	typeConnack    = 2
+	typePublish    = 3
+	typePuback     = 4
+	typeSubscribe  = 8
+	typeSuback     = 9
+	typePingreq    = 12
+	typePingresp   = 13
+	typeDisconnect = 14
+)
+
+// connect flags
+const (
+	flagCleanSession = 0x02
+	flagWill         = 0x04
+	flagWillRetain   = 0x20
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+// maxLength is the largest remaining length of a packet
+const maxLength = 268435455
+
+var errMalformed = errors.New("Malformed MQTT packet")
+
+// connackErrors are the reasons of the brokers refusing a connection
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// packet is a control packet: its type and flags, and the bytes following the fixed header
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// encode returns the packet with its fixed header
+func (p packet) encode() []byte {
+	b := []byte{p.kind<<4 | p.flags}
+	length := len(p.body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(b, p.body...)
+}
+
+// readPacket reads the next packet sent by the broker
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	length, multiplier := 0, 1
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length += int(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+		if multiplier > 128*128*128 {
+			return packet{}, errMalformed
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+
+	return packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// appendString appends a length-prefixed string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a length-prefixed string, and returns the bytes following it
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errMalformed
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errMalformed
+	}
+
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// connectPacket returns the CONNECT packet of the options
+func connectPacket(opts Options) packet {
+	flags := byte(flagCleanSession)
+	if opts.Will != nil {
+		flags |= flagWill
+		if opts.Will.Retain {
+			flags |= flagWillRetain
+		}
+	}
+	if opts.Username != "" {
+		flags |= flagUsername
+		if opts.Password != "" {
+			flags |= flagPassword
+		}
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 3.1.1
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive.Seconds()))
+	body = appendString(body, opts.ClientID)
+	if opts.Will != nil {
+		body = appendString(body, opts.Will.Topic)
+		body = appendString(body, string(opts.Will.Payload))
+	}
+	if flags&flagUsername != 0 {
+		body = appendString(body, opts.Username)
+	}
+	if flags&flagPassword != 0 {
+		body = appendString(body, opts.Password)
+	}
+
+	return packet{kind: typeConnect, body: body}
+}
+
+// checkConnack returns the error of a broker refusing the connection
+func checkConnack(p packet) error {
+	if p.kind != typeConnack || len(p.body) != 2 {
+		return fmt.Errorf("Unexpected MQTT packet %d instead of CONNACK", p.kind)
+	}
+	if code := p.body[1]; code != 0 {
+		reason, ok := connackErrors[code]
+		if !ok {
+			reason = fmt.Sprintf("code %d", code)
+		}
+		return fmt.Errorf("Connection refused by the broker: %s", reason)
+	}
+
+	return nil
+}
+
+// publishPacket returns a PUBLISH packet of QoS 0
+func publishPacket(m Message) (packet, error) {
+	body := appendString(nil, m.Topic)
+	body = append(body, m.Payload...)
+	if len(body) > maxLength {
+		return packet{}, fmt.Errorf("Message of %d bytes too large", len(m.Payload))
+	}
+
+	var flags byte
+	if m.Retain {
+		flags = 0x01
+	}
+
+	return packet{kind: typePublish, flags: flags, body: body}, nil
+}
+
+// decodePublish reads a PUBLISH packet, and returns its packet identifier for QoS 1 and 2
+func decodePublish(p packet) (Message, uint16, error) {
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return Message{}, 0, err
+	}
+
+	var id uint16
+	if qos := (p.flags >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, errMalformed
+		}
+		id, rest = binary.BigEndian.Uint16(rest), rest[2:]
+	}
+
+	return Message{Topic: topic, Payload: rest, Retain: p.flags&0x01 != 0}, id, nil
+}
+
+// subscribePacket returns a SUBSCRIBE packet of the filters, at QoS 0
+func subscribePacket(id uint16, filters []string) packet {
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, filter := range filters {
+		body = appendString(body, filter)
+		body = append(body, 0)
+	}
+
+	return packet{kind: typeSubscribe, flags: 0x02, body: body}
+}
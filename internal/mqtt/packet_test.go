@@ -0,0 +1,94 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRemainingLength(t *testing.T) {
+	for _, test := range []struct {
+		length int
+		header []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+	} {
+		p := packet{kind: typePublish, flags: 0x01, body: bytes.Repeat([]byte{'x'}, test.length)}
+		data := p.encode()
+
+		if header := data[1 : 1+len(test.header)]; !bytes.Equal(header, test.header) {
+			t.Errorf("length %d encoded as %x, want %x", test.length, header, test.header)
+			continue
+		}
+
+		read, err := readPacket(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Errorf("length %d: %v", test.length, err)
+			continue
+		}
+		if read.kind != p.kind || read.flags != p.flags || len(read.body) != test.length {
+			t.Errorf("length %d read as type %d, flags %d and %d bytes", test.length, read.kind, read.flags, len(read.body))
+		}
+	}
+}
+
+func TestReadPacketMalformed(t *testing.T) {
+	// the remaining length has at most 4 bytes
+	data := []byte{typePublish << 4, 0xff, 0xff, 0xff, 0xff, 0x01}
+	if _, err := readPacket(bufio.NewReader(bytes.NewReader(data))); !errors.Is(err, errMalformed) {
+		t.Fatalf("got %v, want errMalformed", err)
+	}
+}
+
+func TestDecodePublish(t *testing.T) {
+	body := appendString(nil, "yeego/desk/set")
+	body = append(body, 0x12, 0x34)
+	body = append(body, `{"state":"ON"}`...)
+
+	// QoS 1, retained
+	m, id, err := decodePublish(packet{kind: typePublish, flags: 0x02 | 0x01, body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Topic != "yeego/desk/set" || string(m.Payload) != `{"state":"ON"}` || !m.Retain || id != 0x1234 {
+		t.Fatalf("got %s %s retained %t with id %x", m.Topic, m.Payload, m.Retain, id)
+	}
+
+	// QoS 0 has no packet identifier
+	m, id, err = decodePublish(packet{kind: typePublish, body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 0 || len(m.Payload) != len(body)-2-len("yeego/desk/set") {
+		t.Fatalf("got id %x and payload %q", id, m.Payload)
+	}
+
+	if _, _, err := decodePublish(packet{kind: typePublish, flags: 0x02, body: appendString(nil, "t")}); !errors.Is(err, errMalformed) {
+		t.Fatalf("QoS 1 without identifier: got %v, want errMalformed", err)
+	}
+}
+
+func TestCheckConnack(t *testing.T) {
+	for _, test := range []struct {
+		p   packet
+		err string
+	}{
+		{packet{kind: typeConnack, body: []byte{0, 0}}, ""},
+		{packet{kind: typeConnack, body: []byte{0, 4}}, "bad user name or password"},
+		{packet{kind: typeConnack, body: []byte{0, 42}}, "code 42"},
+		{packet{kind: typeConnack, body: []byte{0}}, "instead of CONNACK"},
+		{packet{kind: typeSuback, body: []byte{0, 0}}, "instead of CONNACK"},
+	} {
+		err := checkConnack(test.p)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("type %d with %v: got %v, want %q", test.p.kind, test.p.body, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Easing is the curve followed between two keyframes
+type Easing string
+
+// Easing curves
+const (
+	Linear    Easing = "linear"
+	EaseInOut Easing = "ease-in-out"
+	Cubic     Easing = "cubic"
+	Step      Easing = "step"
+	Sine      Easing = "sine"
+)
+
+var errInvalidAnimation = errors.New("Invalid animation")
+
+// ease returns the progress along the curve at t, between 0 and 1
+func (e Easing) ease(t float64) float64 {
+	switch e {
+	case EaseInOut:
+		if t < 0.5 {
+			return 4 * t * t * t
+		}
+		return 1 - math.Pow(-2*t+2, 3)/2
+	case Cubic:
+		return t * t * t
+	case Step:
+		if t < 1 {
+			return 0
+		}
+		return 1
+	case Sine:
+		return (1 - math.Cos(math.Pi*t)) / 2
+	default:
+		return t
+	}
+}
+
+// Frame is the state of a light at an instant of an animation.
+// The color is the RGB value, unless a color temperature is set.
+type Frame struct {
+	Bright    int
+	RGB       int
+	ColorTemp int
+}
+
+// Keyframe is a state reached at an instant of an animation. The easing is
+// followed from this keyframe to the next one.
+type Keyframe struct {
+	At     time.Duration
+	Frame  Frame
+	Easing Easing
+}
+
+// Jitter adds random variations to every frame, for organic effects like fire.
+type Jitter struct {
+	Bright int // maximum brightness added or removed
+	Hue    int // maximum hue rotation in degrees
+}
+
+// Animation is an effect rendered by the host, frame by frame.
+type Animation struct {
+	Keyframes []Keyframe
+	FPS       float64 // frames sent per second
+	Loop      bool    // start again after the last keyframe
+	Jitter    Jitter
+}
+
+// Validate checks the animation can be played.
+func (a Animation) Validate() error {
+	if len(a.Keyframes) == 0 {
+		return fmt.Errorf("%w: no keyframe", errInvalidAnimation)
+	}
+
+	if a.FPS <= 0 || a.FPS > 60 {
+		return fmt.Errorf("%w: frame rate must be between 0 and 60", errInvalidAnimation)
+	}
+
+	for _, k := range a.Keyframes {
+		switch {
+		case k.At < 0:
+			return fmt.Errorf("%w: negative keyframe instant %v", errInvalidAnimation, k.At)
+		case k.Frame.Bright < 1 || k.Frame.Bright > 100:
+			return fmt.Errorf("%w: brightness %d out of range", errInvalidAnimation, k.Frame.Bright)
+		case k.Frame.ColorTemp != 0 && (k.Frame.ColorTemp < minColorTemp || k.Frame.ColorTemp > maxColorTemp):
+			return fmt.Errorf("%w: color temperature %d out of range", errInvalidAnimation, k.Frame.ColorTemp)
+		case k.Frame.RGB < 0 || k.Frame.RGB > 0xffffff:
+			return fmt.Errorf("%w: color %d out of range", errInvalidAnimation, k.Frame.RGB)
+		}
+
+		switch k.Easing {
+		case "", Linear, EaseInOut, Cubic, Step, Sine:
+		default:
+			return fmt.Errorf("%w: unknown easing %q", errInvalidAnimation, k.Easing)
+		}
+	}
+
+	return nil
+}
+
+// Duration returns the instant of the last keyframe.
+func (a Animation) Duration() time.Duration {
+	var d time.Duration
+	for _, k := range a.Keyframes {
+		if k.At > d {
+			d = k.At
+		}
+	}
+
+	return d
+}
+
+// At returns the frame of the animation at the instant t, without jitter.
+func (a Animation) At(t time.Duration) Frame {
+	keyframes := append([]Keyframe(nil), a.Keyframes...)
+	sort.SliceStable(keyframes, func(i, j int) bool { return keyframes[i].At < keyframes[j].At })
+
+	if a.Loop && a.Duration() > 0 {
+		t %= a.Duration()
+	}
+
+	if t <= keyframes[0].At {
+		return keyframes[0].Frame
+	}
+
+	for i := 0; i < len(keyframes)-1; i++ {
+		from, to := keyframes[i], keyframes[i+1]
+		if t >= to.At {
+			continue
+		}
+
+		progress := from.Easing.ease(float64(t-from.At) / float64(to.At-from.At))
+		return interpolate(from.Frame, to.Frame, progress)
+	}
+
+	return keyframes[len(keyframes)-1].Frame
+}
+
+// interpolate returns the frame at the given progress from one frame to another
+func interpolate(from, to Frame, progress float64) Frame {
+	mix := func(a, b int) int {
+		return int(math.Round(float64(a) + (float64(b)-float64(a))*progress))
+	}
+
+	frame := Frame{Bright: mix(from.Bright, to.Bright)}
+	if from.ColorTemp != 0 && to.ColorTemp != 0 {
+		frame.ColorTemp = mix(from.ColorTemp, to.ColorTemp)
+		return frame
+	}
+
+	fromRGB, toRGB := from.RGB, to.RGB
+	if from.ColorTemp != 0 {
+		fromRGB = colorTempToRGB(from.ColorTemp)
+	}
+	if to.ColorTemp != 0 {
+		toRGB = colorTempToRGB(to.ColorTemp)
+	}
+
+	fr, fg, fb := splitRGB(fromRGB)
+	tr, tg, tb := splitRGB(toRGB)
+	frame.RGB = joinRGB(mix(fr, tr), mix(fg, tg), mix(fb, tb))
+	return frame
+}
+
+// jitter applies random variations to the frame
+func (j Jitter) apply(f Frame, rnd *rand.Rand) Frame {
+	if j.Bright > 0 {
+		f.Bright = clamp(f.Bright+rnd.Intn(2*j.Bright+1)-j.Bright, 1, 100)
+	}
+
+	if j.Hue > 0 {
+		if f.ColorTemp != 0 {
+			f.RGB, f.ColorTemp = colorTempToRGB(f.ColorTemp), 0
+		}
+		f.RGB = HueShift(rnd.Intn(2*j.Hue+1) - j.Hue)(f.RGB)
+	}
+
+	return f
+}
+
+// FrameRenderer sends the frames of an animation to a light, skipping the
+// values which did not change since the previous frame.
+type FrameRenderer struct {
+	sender *Sender
+	last   Frame
+}
+
+// NewFrameRenderer returns a renderer sending frames through the sender.
+func NewFrameRenderer(s *Sender) *FrameRenderer {
+	return &FrameRenderer{sender: s}
+}
+
+// Render sends a frame, with a transition of the given duration.
+func (r *FrameRenderer) Render(ctx context.Context, f Frame, transition time.Duration) error {
+	effect, ms := "smooth", int(transition.Milliseconds())
+	if ms < 30 {
+		effect, ms = "sudden", 0
+	}
+
+	var err error
+	switch {
+	case f.ColorTemp != 0 && f.ColorTemp != r.last.ColorTemp:
+		err = r.sender.Send(ctx, "set_ct_abx", f.ColorTemp, effect, ms)
+	case f.ColorTemp == 0 && (f.RGB != r.last.RGB || r.last.ColorTemp != 0):
+		err = r.sender.Send(ctx, "set_rgb", f.RGB, effect, ms)
+	}
+	if err != nil {
+		return err
+	}
+
+	if f.Bright != r.last.Bright {
+		if err := r.sender.Send(ctx, "set_bright", f.Bright, effect, ms); err != nil {
+			return err
+		}
+	}
+
+	r.last = f
+	return nil
+}
+
+// Animate plays the animation on the lights until it ends or the context is
+// cancelled. Frames go through music mode sessions when the lights support it,
+// host is the local address given to the lights, found automatically when empty.
+// Each light gets its own jitter.
+func Animate(ctx context.Context, a Animation, lights []*Yeelight, host string) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	renderers := make([]*FrameRenderer, len(lights))
+	for i, light := range lights {
+		sender := NewSender(light, host)
+		defer sender.Close()
+		renderers[i] = NewFrameRenderer(sender)
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	interval := time.Duration(float64(time.Second) / a.FPS)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		elapsed := time.Since(start)
+		frame := a.At(elapsed)
+
+		var errs []error
+		for _, r := range renderers {
+			errs = append(errs, r.Render(ctx, a.Jitter.apply(frame, rnd), interval))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+
+		if !a.Loop && elapsed >= a.Duration() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
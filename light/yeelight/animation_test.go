@@ -0,0 +1,116 @@
+package yeelight
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestEase(t *testing.T) {
+	for _, test := range []struct {
+		easing Easing
+		t      float64
+		want   float64
+	}{
+		{"", 0.25, 0.25},
+		{Linear, 0.75, 0.75},
+		{EaseInOut, 0, 0},
+		{EaseInOut, 0.25, 0.0625},
+		{EaseInOut, 0.5, 0.5},
+		{EaseInOut, 0.75, 0.9375},
+		{EaseInOut, 1, 1},
+		{Cubic, 0.5, 0.125},
+		{Cubic, 1, 1},
+		{Step, 0, 0},
+		{Step, 0.99, 0},
+		{Step, 1, 1},
+		{Sine, 0, 0},
+		{Sine, 0.5, 0.5},
+		{Sine, 1, 1},
+	} {
+		if got := test.easing.ease(test.t); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%q at %v: got %v, want %v", test.easing, test.t, got, test.want)
+		}
+	}
+}
+
+func TestAnimationAt(t *testing.T) {
+	// the keyframes are sorted by their instant
+	a := Animation{Keyframes: []Keyframe{
+		{At: time.Second, Frame: Frame{Bright: 100, RGB: 0xff0000}, Easing: Step},
+		{At: 0, Frame: Frame{Bright: 10, RGB: 0x000000}},
+		{At: 2 * time.Second, Frame: Frame{Bright: 50, ColorTemp: 2700}, Easing: Linear},
+		{At: 3 * time.Second, Frame: Frame{Bright: 30, ColorTemp: 6500}},
+	}}
+
+	for _, test := range []struct {
+		t    time.Duration
+		want Frame
+	}{
+		{0, Frame{Bright: 10, RGB: 0x000000}},
+		{500 * time.Millisecond, Frame{Bright: 55, RGB: 0x800000}},
+		{time.Second, Frame{Bright: 100, RGB: 0xff0000}},
+		// the step holds the keyframe until the next one
+		{1900 * time.Millisecond, Frame{Bright: 100, RGB: 0xff0000}},
+		{2 * time.Second, Frame{Bright: 50, ColorTemp: 2700}},
+		// between two color temperatures, the temperature is interpolated
+		{2500 * time.Millisecond, Frame{Bright: 40, ColorTemp: 4600}},
+		{4 * time.Second, Frame{Bright: 30, ColorTemp: 6500}},
+	} {
+		if got := a.At(test.t); got != test.want {
+			t.Errorf("at %v: got %+v, want %+v", test.t, got, test.want)
+		}
+	}
+
+	a.Loop = true
+	if got, want := a.At(3500*time.Millisecond), a.At(500*time.Millisecond); got != want {
+		t.Errorf("looping: got %+v, want %+v", got, want)
+	}
+}
+
+func TestInterpolateColorTemp(t *testing.T) {
+	// from a color temperature to a color, the temperature is converted
+	from := Frame{Bright: 20, ColorTemp: 2700}
+	to := Frame{Bright: 40, RGB: 0x0000ff}
+
+	if got, want := interpolate(from, to, 0), (Frame{Bright: 20, RGB: colorTempToRGB(2700)}); got != want {
+		t.Errorf("start: got %+v, want %+v", got, want)
+	}
+	if got := interpolate(from, to, 1); got != to {
+		t.Errorf("end: got %+v, want %+v", got, to)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	frame := Frame{Bright: 95, RGB: 0xff0000}
+	if got := (Jitter{}).apply(frame, rnd); got != frame {
+		t.Errorf("without jitter: got %+v, want %+v", got, frame)
+	}
+
+	j := Jitter{Bright: 10, Hue: 30}
+	brights := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		got := j.apply(frame, rnd)
+		brights[got.Bright] = true
+
+		if got.Bright < 85 || got.Bright > 100 {
+			t.Fatalf("brightness %d beyond the jitter of %d", got.Bright, frame.Bright)
+		}
+
+		hue, sat, _ := rgbToHSV(got.RGB)
+		if distance := math.Min(hue, 360-hue); distance > 30.5 || math.Abs(sat-100) > 1 {
+			t.Fatalf("color %06x beyond the jitter of red: hue %v, saturation %v", got.RGB, hue, sat)
+		}
+	}
+	if len(brights) != 16 {
+		t.Errorf("got %d brightness values, want 85 to 100", len(brights))
+	}
+
+	// the hue of a color temperature is jittered as a color
+	if got := (Jitter{Hue: 10}).apply(Frame{Bright: 50, ColorTemp: 2700}, rnd); got.ColorTemp != 0 || got.RGB == 0 {
+		t.Errorf("color temperature jittered to %+v", got)
+	}
+}
@@ -0,0 +1,271 @@
+package yeelight
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Dialer opens the connections to the lights. *net.Dialer implements it,
+// tests and proxies can provide their own transport.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// RateLimiter delays requests to stay under the quota of the lights.
+type RateLimiter interface {
+	// Wait blocks until a request can be sent to the light at location.
+	Wait(ctx context.Context, location string) error
+}
+
+// Client holds the settings used to talk to the lights. Clients are
+// independent from each other and safe for concurrent use.
+type Client struct {
+	dialTimeout time.Duration
+	readTimeout time.Duration
+	dialer      Dialer
+	multicast   string
+	port        string
+	logger      *slog.Logger
+	limiter     RateLimiter
+
+	mu          sync.RWMutex
+	retry       RetryPolicy
+	middlewares []Middleware
+
+	lastID atomic.Int64
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithDialTimeout sets the maximum time to open a connection to a light.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *Client) { c.dialTimeout = d }
+}
+
+// WithReadTimeout sets the maximum time to wait for the answer of a light.
+func WithReadTimeout(d time.Duration) Option {
+	return func(c *Client) { c.readTimeout = d }
+}
+
+// WithDialer replaces the dialer used to connect to the lights.
+func WithDialer(d Dialer) Option {
+	return func(c *Client) { c.dialer = d }
+}
+
+// WithMulticast changes the SSDP multicast group used for discovery.
+func WithMulticast(addr string) Option {
+	return func(c *Client) { c.multicast = addr }
+}
+
+// WithPort changes the port used for lights given without one.
+func WithPort(port string) Option {
+	return func(c *Client) { c.port = port }
+}
+
+// WithLogger logs every exchange with the lights on the given logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) { c.logger = logger }
+}
+
+// WithRateLimiter delays the requests using the given limiter.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(c *Client) { c.limiter = l }
+}
+
+// WithRetryPolicy sets how failed requests are retried.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) { c.retry = p }
+}
+
+// WithMiddleware appends middlewares to the chain wrapping every request.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Client) { c.middlewares = append(c.middlewares, mw...) }
+}
+
+// DefaultClient is the client used by lights not bound to another one.
+var DefaultClient = NewClient()
+
+// NewClient returns a client configured with the given options.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		dialTimeout: 2 * time.Second,
+		readTimeout: 5 * time.Second,
+		dialer:      &net.Dialer{},
+		multicast:   "239.255.255.250:1982",
+		port:        Port,
+		retry:       RetryPolicy{MaxAttempts: 1},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Use appends middlewares to the chain wrapping every request of the client.
+// The first middleware registered is the outermost one.
+func (c *Client) Use(mw ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.middlewares = append(c.middlewares, mw...)
+}
+
+// SetRetryPolicy changes how failed requests of the client are retried.
+// Retries wrap the middlewares, so each attempt goes through them.
+func (c *Client) SetRetryPolicy(p RetryPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.retry = p
+}
+
+// Light returns a light bound to the client from its IP address,
+// with or without port.
+func (c *Client) Light(addr string) *Yeelight {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, c.port)
+	}
+
+	return &Yeelight{Location: addr, client: c}
+}
+
+// Bind makes the client send the requests of the light.
+func (c *Client) Bind(y *Yeelight) *Yeelight {
+	y.client = c
+	return y
+}
+
+// nextID returns an id not used by the predefined commands
+func (c *Client) nextID() int {
+	return int(c.lastID.Add(1)) + 100
+}
+
+// handler builds the chain of handlers of a request
+func (c *Client) handler() Handler {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	mw := []Middleware{Retry(c.retry)}
+	if c.logger != nil {
+		mw = append(mw, WireLogger(c.logger))
+	}
+	mw = append(mw, c.middlewares...)
+	if c.limiter != nil {
+		mw = append(mw, limit(c.limiter))
+	}
+
+	return chain(c.send, mw)
+}
+
+// do sends a command to the light through the middlewares
+func (c *Client) do(ctx context.Context, y *Yeelight, cmd Command) (Response, error) {
+	ex := &Exchange{Light: y, Command: cmd}
+
+	// the notification of the change may arrive before the response
+	var before Yeelight
+	if y.live != nil {
+		before, _ = y.live.State()
+	}
+
+	err := c.handler()(ctx, ex)
+	if err == nil && y.live != nil {
+		y.live.applyCommand(before, ex.Command, ex.Response)
+	}
+
+	return ex.Response, err
+}
+
+// limit waits for the rate limiter before each attempt
+func limit(l RateLimiter) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, ex *Exchange) error {
+			if err := l.Wait(ctx, ex.Light.Location); err != nil {
+				return err
+			}
+
+			return next(ctx, ex)
+		}
+	}
+}
+
+// dial opens a connection to the light at location
+func (c *Client) dial(ctx context.Context, location string) (net.Conn, error) {
+	if c.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialTimeout)
+		defer cancel()
+	}
+
+	conn, err := c.dialer.DialContext(ctx, "tcp", location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errResolveTCP, err)
+	}
+
+	return conn, nil
+}
+
+// send is the innermost handler, it writes the command to the light and reads its answer
+func (c *Client) send(ctx context.Context, ex *Exchange) error {
+	start := time.Now()
+	defer func() { ex.Duration = time.Since(start) }()
+
+	conn, err := c.dial(ctx, ex.Light.Location)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// unblock the connection if the context is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	cmdJSON, err := json.Marshal(ex.Command)
+	if err != nil {
+		return errInvalidParam
+	}
+	ex.Request = cmdJSON
+
+	if _, err := fmt.Fprintf(conn, "%s\r\n", cmdJSON); err != nil {
+		return fmt.Errorf("%w: %w", errConnectLight, err)
+	}
+
+	if c.readTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err != nil {
+			return fmt.Errorf("%w: %w", errConnectLight, err)
+		}
+		ex.Reply = bytes.TrimSpace(data)
+
+		// parse response, skipping the notifications sent by the light
+		resp, notification, err := decodeResponse(ex.Reply)
+		if err != nil {
+			return err
+		}
+		if !notification {
+			ex.Response = resp
+			break
+		}
+	}
+
+	if ex.Response.Error.Code != 0 {
+		return ex.Response.Error
+	}
+
+	return nil
+}
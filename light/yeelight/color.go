@@ -0,0 +1,199 @@
+package yeelight
+
+import "math"
+
+// Color temperature range of the lights, in kelvin
+const (
+	minColorTemp = 1700
+	maxColorTemp = 6500
+)
+
+// splitRGB splits a 0xRRGGBB color in its components
+func splitRGB(rgb int) (r, g, b int) {
+	return (rgb >> 16) & 0xff, (rgb >> 8) & 0xff, rgb & 0xff
+}
+
+// joinRGB builds a 0xRRGGBB color from its components
+func joinRGB(r, g, b int) int {
+	return (clamp(r, 0, 255) << 16) | (clamp(g, 0, 255) << 8) | clamp(b, 0, 255)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+
+	return v
+}
+
+// HSVToRGB converts a hue (0-359) and saturation (0-100) at full value to a 0xRRGGBB color.
+func HSVToRGB(hue, sat float64) int {
+	h := math.Mod(hue, 360) / 60
+	if h < 0 {
+		h += 6
+	}
+	s := math.Max(0, math.Min(sat, 100)) / 100
+
+	c := s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+
+	m := 1 - c
+	return joinRGB(int(math.Round((r+m)*255)), int(math.Round((g+m)*255)), int(math.Round((b+m)*255)))
+}
+
+// linear converts a sRGB component to linear light
+func linear(c int) float64 {
+	v := float64(c) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// xyz converts a 0xRRGGBB color to the CIE XYZ color space
+func xyz(rgb int) (x, y, z float64) {
+	r, g, b := splitRGB(rgb)
+	lr, lg, lb := linear(r), linear(g), linear(b)
+
+	return 0.4124*lr + 0.3576*lg + 0.1805*lb,
+		0.2126*lr + 0.7152*lg + 0.0722*lb,
+		0.0193*lr + 0.1192*lg + 0.9505*lb
+}
+
+// uv returns the CIE 1960 chromaticity of a xy chromaticity
+func uv(x, y float64) (u, v float64) {
+	d := -2*x + 12*y + 3
+	return 4 * x / d, 6 * y / d
+}
+
+// planckian returns the xy chromaticity of a black body at the given temperature,
+// using the approximation of Kim et al.
+func planckian(t float64) (x, y float64) {
+	if t <= 4000 {
+		x = -0.2661239e9/(t*t*t) - 0.2343589e6/(t*t) + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/(t*t*t) + 2.1070379e6/(t*t) + 0.2226347e3/t + 0.240390
+	}
+
+	switch {
+	case t <= 2222:
+		y = -1.1063814*x*x*x - 1.34811020*x*x + 2.18555832*x - 0.20219683
+	case t <= 4000:
+		y = -0.9549476*x*x*x - 1.37418593*x*x + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x*x*x - 5.87338670*x*x + 3.75112997*x - 0.37001483
+	}
+
+	return x, y
+}
+
+// rgbToColorTemp returns the color temperature supported by the lights
+// which is the nearest to the given color
+func rgbToColorTemp(rgb int) int {
+	X, Y, Z := xyz(rgb)
+	if X+Y+Z == 0 {
+		// black has no chromaticity, use a neutral white
+		return 4000
+	}
+	u, v := uv(X/(X+Y+Z), Y/(X+Y+Z))
+
+	best, bestDist := minColorTemp, math.Inf(1)
+	for t := minColorTemp; t <= maxColorTemp; t += 50 {
+		pu, pv := uv(planckian(float64(t)))
+		if d := math.Hypot(u-pu, v-pv); d < bestDist {
+			best, bestDist = t, d
+		}
+	}
+
+	return best
+}
+
+// colorTempToRGB returns an approximation of the color of a black body at the given temperature
+func colorTempToRGB(t int) int {
+	x, y := planckian(float64(clamp(t, minColorTemp, maxColorTemp)))
+	X, Z := x/y, (1-x-y)/y
+
+	// XYZ to linear sRGB, scaled so that the brightest component is 1
+	r := 3.2406*X - 1.5372 - 0.4986*Z
+	g := -0.9689*X + 1.8758 + 0.0415*Z
+	b := 0.0557*X - 0.2040 + 1.0570*Z
+	m := math.Max(r, math.Max(g, b))
+
+	gamma := func(c float64) int {
+		c = math.Max(0, c/m)
+		if c <= 0.0031308 {
+			return int(math.Round(c * 12.92 * 255))
+		}
+		return int(math.Round((1.055*math.Pow(c, 1/2.4) - 0.055) * 255))
+	}
+
+	return joinRGB(gamma(r), gamma(g), gamma(b))
+}
+
+// perceivedBrightness returns the CIE lightness L* of the color, from 1 to 100
+func perceivedBrightness(rgb int) int {
+	_, Y, _ := xyz(rgb)
+
+	l := 903.3 * Y
+	if Y > 0.008856 {
+		l = 116*math.Cbrt(Y) - 16
+	}
+
+	return clamp(int(math.Round(l)), 1, 100)
+}
+
+// rgbToHSV converts a 0xRRGGBB color to a hue (0-359), saturation and value (0-100)
+func rgbToHSV(rgb int) (hue, sat, val float64) {
+	r, g, b := splitRGB(rgb)
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	d := max - min
+
+	switch {
+	case d == 0:
+		hue = 0
+	case max == rf:
+		hue = 60 * math.Mod((gf-bf)/d, 6)
+	case max == gf:
+		hue = 60 * ((bf-rf)/d + 2)
+	default:
+		hue = 60 * ((rf-gf)/d + 4)
+	}
+	if hue < 0 {
+		hue += 360
+	}
+
+	if max > 0 {
+		sat = d / max * 100
+	}
+
+	return hue, sat, max * 100
+}
+
+// HueShift returns a color mapping rotating the hue of colors by the given degrees.
+func HueShift(degrees int) func(rgb int) int {
+	return func(rgb int) int {
+		hue, sat, _ := rgbToHSV(rgb)
+		return HSVToRGB(hue+float64(degrees), sat)
+	}
+}
@@ -0,0 +1,93 @@
+package yeelight
+
+import "testing"
+
+func TestHSVToRGB(t *testing.T) {
+	for _, test := range []struct {
+		hue, sat float64
+		rgb      int
+	}{
+		{0, 100, 0xff0000},
+		{60, 100, 0xffff00},
+		{120, 100, 0x00ff00},
+		{180, 100, 0x00ffff},
+		{240, 100, 0x0000ff},
+		{300, 100, 0xff00ff},
+		{360, 100, 0xff0000},
+		{-120, 100, 0x0000ff},
+		{0, 50, 0xff8080},
+		{200, 0, 0xffffff},
+		{30, 150, 0xff8000},
+	} {
+		if rgb := HSVToRGB(test.hue, test.sat); rgb != test.rgb {
+			t.Errorf("HSVToRGB(%v, %v): got %06x, want %06x", test.hue, test.sat, rgb, test.rgb)
+		}
+	}
+}
+
+func TestRGBToHSV(t *testing.T) {
+	for _, test := range []struct {
+		rgb           int
+		hue, sat, val float64
+	}{
+		{0xff0000, 0, 100, 100},
+		{0x00ff00, 120, 100, 100},
+		{0x0000ff, 240, 100, 100},
+		{0xff00ff, 300, 100, 100},
+		{0xffffff, 0, 0, 100},
+		{0x000000, 0, 0, 0},
+	} {
+		if hue, sat, val := rgbToHSV(test.rgb); hue != test.hue || sat != test.sat || val != test.val {
+			t.Errorf("rgbToHSV(%06x): got %v %v %v, want %v %v %v", test.rgb, hue, sat, val, test.hue, test.sat, test.val)
+		}
+	}
+
+	if rgb := HueShift(120)(0xff0000); rgb != 0x00ff00 {
+		t.Errorf("red shifted by 120: got %06x, want 00ff00", rgb)
+	}
+}
+
+func TestColorTemp(t *testing.T) {
+	for _, test := range []struct {
+		rgb int
+		ct  int
+	}{
+		{0xffffff, 6500}, // D65, the white of sRGB
+		{0x000000, 4000}, // no chromaticity
+		{0xff0000, 1700}, // saturated colors end at the ends of the range
+		{0x0000ff, 6500},
+	} {
+		if ct := rgbToColorTemp(test.rgb); ct != test.ct {
+			t.Errorf("rgbToColorTemp(%06x): got %d, want %d", test.rgb, ct, test.ct)
+		}
+	}
+
+	// the colors of the black body go back to their temperature
+	for _, ct := range []int{1700, 2000, 2700, 4000, 5000, 6500} {
+		rgb := colorTempToRGB(ct)
+		if got := rgbToColorTemp(rgb); got < ct-100 || got > ct+100 {
+			t.Errorf("%dK is %06x, read back as %dK", ct, rgb, got)
+		}
+	}
+
+	if rgb := colorTempToRGB(6500); rgb < 0xf0f0f0 {
+		t.Errorf("6500K: got %06x, want a white", rgb)
+	}
+}
+
+func TestPerceivedBrightness(t *testing.T) {
+	for _, test := range []struct {
+		rgb    int
+		bright int
+	}{
+		{0xffffff, 100},
+		{0x808080, 54},
+		{0xff0000, 53},
+		{0x0000ff, 32},
+		{0x000000, 1},
+	} {
+		if bright := perceivedBrightness(test.rgb); bright != test.bright {
+			t.Errorf("perceivedBrightness(%06x): got %d, want %d", test.rgb, bright, test.bright)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package yeelight
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Conn is a connection kept open to a light. Commands sent on it skip the
+// middlewares of the client, which makes it suited to latency sensitive uses.
+// A Conn is safe for concurrent use, commands are sent one at a time.
+type Conn struct {
+	light  *Yeelight
+	conn   net.Conn
+	reader *bufio.Reader
+
+	mu     sync.Mutex
+	lastID int
+}
+
+// Dial opens a connection to the light.
+func (y *Yeelight) Dial(ctx context.Context) (*Conn, error) {
+	conn, err := y.clientOrDefault().dial(ctx, y.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{light: y, conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// Light returns the light the connection is open to.
+func (c *Conn) Light() *Yeelight {
+	return c.light
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// write sends a command without waiting for its response
+func (c *Conn) write(method string, params []interface{}) (int, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	c.lastID++
+	cmdJSON, err := json.Marshal(Command{ID: c.lastID, Method: method, Params: params})
+	if err != nil {
+		return 0, errInvalidParam
+	}
+
+	if _, err := fmt.Fprintf(c.conn, "%s\r\n", cmdJSON); err != nil {
+		return 0, fmt.Errorf("%w: %w", errConnectLight, err)
+	}
+
+	return c.lastID, nil
+}
+
+// read waits for the response to the command with the given id, skipping notifications
+func (c *Conn) read(ctx context.Context, id int) (Response, error) {
+	// also clears the deadline left by a read cancelled before
+	deadline, _ := ctx.Deadline()
+	c.conn.SetReadDeadline(deadline)
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	// unblock the read if the context is cancelled
+	stop := context.AfterFunc(ctx, func() { c.conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	for {
+		data, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return Response{}, ctx.Err()
+			}
+			return Response{}, fmt.Errorf("%w: %w", errConnectLight, err)
+		}
+
+		resp, notification, err := decodeResponse(bytes.TrimSpace(data))
+		if err != nil {
+			return Response{}, err
+		}
+		if notification || resp.ID != id {
+			continue
+		}
+
+		if resp.Error.Code != 0 {
+			return resp, resp.Error
+		}
+
+		return resp, nil
+	}
+}
+
+// Call sends a method on the connection and waits for its response.
+func (c *Conn) Call(ctx context.Context, method string, params ...interface{}) (Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, err := c.write(method, params)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return c.read(ctx, id)
+}
@@ -0,0 +1,40 @@
+package yeelight
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnCallCancelled(t *testing.T) {
+	client, light := net.Pipe()
+	defer client.Close()
+	defer light.Close()
+
+	// a light reading the commands and never answering
+	go io.Copy(io.Discard, light)
+
+	conn := &Conn{light: &Yeelight{}, conn: client, reader: bufio.NewReader(client)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Call(ctx, "set_power", "on")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Call still blocked after the context was cancelled")
+	}
+}
@@ -0,0 +1,197 @@
+package yeelight
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidResponse = errors.New("Invalid response from light")
+	errNotOK           = errors.New("Light did not acknowledge the command")
+	errInvalidProp     = errors.New("Invalid property value")
+	errInvalidAdvert   = errors.New("Invalid discovery answer")
+)
+
+// decodeResponse parses a line sent by the light. Notifications, which carry a
+// method instead of an id, are reported with notification set to true.
+func decodeResponse(data []byte) (resp Response, notification bool, err error) {
+	var raw struct {
+		ID     *int            `json:"id"`
+		Method string          `json:"method"`
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Response{}, false, fmt.Errorf("%w: %w", errInvalidResponse, err)
+	}
+
+	if raw.ID == nil {
+		if raw.Method != "" {
+			return Response{}, true, nil
+		}
+		return Response{}, false, fmt.Errorf("%w: missing id", errInvalidResponse)
+	}
+
+	resp.ID = *raw.ID
+	if raw.Error != nil {
+		resp.Error = *raw.Error
+		if resp.Error.Code == 0 {
+			// the error must be reported even without a code
+			resp.Error.Code = -1
+		}
+		return resp, false, nil
+	}
+
+	if len(raw.Result) == 0 {
+		return Response{}, false, fmt.Errorf("%w: missing result", errInvalidResponse)
+	}
+
+	if err := json.Unmarshal(raw.Result, &resp.Result); err != nil {
+		return Response{}, false, fmt.Errorf("%w: %w", errInvalidResponse, err)
+	}
+
+	return resp, false, nil
+}
+
+// MarshalJSON omits the error of successful responses.
+func (r Response) MarshalJSON() ([]byte, error) {
+	if r.Error.Code != 0 {
+		type response Response
+		return json.Marshal(response(r))
+	}
+
+	return json.Marshal(struct {
+		ID     int         `json:"id"`
+		Result interface{} `json:"result"`
+	}{r.ID, r.Result})
+}
+
+// Strings returns the result of the response as a list of strings.
+// Numbers sent by some firmwares are formatted as strings.
+func (r Response) Strings() ([]string, error) {
+	if r.Error.Code != 0 {
+		return nil, r.Error
+	}
+
+	values, ok := r.Result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: result is not a list", errInvalidResponse)
+	}
+
+	result := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			result[i] = v
+		case float64:
+			result[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("%w: unexpected value %v", errInvalidResponse, v)
+		}
+	}
+
+	return result, nil
+}
+
+// OK returns an error unless the light acknowledged the command with "ok".
+func (r Response) OK() error {
+	result, err := r.Strings()
+	if err != nil {
+		return err
+	}
+
+	if len(result) != 1 || result[0] != "ok" {
+		return fmt.Errorf("%w: %v", errNotOK, result)
+	}
+
+	return nil
+}
+
+// setProp updates the field of the light matching the property name.
+// Unknown properties are ignored, empty values mean the light does not support it.
+func (y *Yeelight) setProp(name, value string) error {
+	var field *int
+	switch name {
+	case "power":
+		y.Power = value
+		return nil
+	case "name":
+		y.Name = value
+		return nil
+	case "bright":
+		field = &y.Bright
+	case "ct":
+		field = &y.ColorTemp
+	case "rgb":
+		field = &y.RGB
+	case "hue":
+		field = &y.Hue
+	case "sat":
+		field = &y.Saturation
+	case "color_mode":
+		field = &y.ColorMode
+	case "fw_ver":
+		field = &y.FWVersion
+	default:
+		return nil
+	}
+
+	if value == "" {
+		*field = 0
+		return nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%w: %s=%q", errInvalidProp, name, value)
+	}
+
+	*field = v
+	return nil
+}
+
+// parseAdvertisement parses a discovery answer or advertisement sent by a light.
+func parseAdvertisement(data []byte) (Yeelight, error) {
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	status, err := tp.ReadLine()
+	if err != nil {
+		return Yeelight{}, fmt.Errorf("%w: %w", errInvalidAdvert, err)
+	}
+
+	if !strings.HasPrefix(status, "HTTP/1.1 200") && !strings.HasPrefix(status, "NOTIFY") {
+		return Yeelight{}, fmt.Errorf("%w: unexpected status %q", errInvalidAdvert, status)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && len(header) == 0 {
+		return Yeelight{}, fmt.Errorf("%w: %w", errInvalidAdvert, err)
+	}
+
+	location, err := url.Parse(header.Get("location"))
+	if err != nil || location.Host == "" {
+		return Yeelight{}, fmt.Errorf("%w: invalid location %q", errInvalidAdvert, header.Get("location"))
+	}
+
+	light := Yeelight{
+		Location: location.Host,
+		ID:       header.Get("id"),
+		Model:    header.Get("model"),
+		Support:  strings.Fields(header.Get("support")),
+	}
+
+	for _, prop := range []string{"fw_ver", "power", "bright", "color_mode", "ct", "rgb", "hue", "sat", "name"} {
+		if err := light.setProp(prop, header.Get(prop)); err != nil {
+			return Yeelight{}, fmt.Errorf("%w: %w", errInvalidAdvert, err)
+		}
+	}
+
+	return light, nil
+}
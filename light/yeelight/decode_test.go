@@ -0,0 +1,74 @@
+package yeelight
+
+import (
+	"reflect"
+	"testing"
+)
+
+func FuzzDecodeResponse(f *testing.F) {
+	f.Add([]byte(`{"id":1,"result":["ok"]}`))
+	f.Add([]byte(`{"id":1,"result":["on","50","4000","16711680","0","100","2","bedroom"]}`))
+	f.Add([]byte(`{"id":1,"result":["on",50,4000]}`))
+	f.Add([]byte(`{"id":2,"error":{"code":-1,"message":"client quota exceeded"}}`))
+	f.Add([]byte(`{"method":"props","params":{"power":"on","bright":"10"}}`))
+	f.Add([]byte(`{"id":3}`))
+	f.Add([]byte(`[]`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		resp, notification, err := decodeResponse(data)
+		if err != nil || notification {
+			return
+		}
+
+		values, err := resp.Strings()
+		if err != nil {
+			return
+		}
+		resp.OK()
+
+		var light Yeelight
+		props := []string{"power", "bright", "ct", "rgb", "hue", "sat", "color_mode", "name"}
+		for i := 0; i < len(values) && i < len(props); i++ {
+			light.setProp(props[i], values[i])
+		}
+	})
+}
+
+func FuzzParseAdvertisement(f *testing.F) {
+	f.Add([]byte("HTTP/1.1 200 OK\r\nCache-Control: max-age=3600\r\nLocation: yeelight://192.168.1.239:55443\r\n" +
+		"id: 0x000000000015243f\r\nmodel: color\r\nfw_ver: 18\r\nsupport: get_prop set_default set_power toggle\r\n" +
+		"power: on\r\nbright: 100\r\ncolor_mode: 2\r\nct: 4000\r\nrgb: 16711680\r\nhue: 100\r\nsat: 35\r\nname: my_bulb\r\n\r\n"))
+	f.Add([]byte("NOTIFY * HTTP/1.1\r\nHost: 239.255.255.250:1982\r\nLocation: yeelight://192.168.1.239:55443\r\nbright: x\r\n"))
+	f.Add([]byte("M-SEARCH * HTTP/1.1\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		light, err := parseAdvertisement(data)
+		if err == nil && light.Location == "" {
+			t.Fatalf("light without location parsed from %q", data)
+		}
+	})
+}
+
+func FuzzParseFlow(f *testing.F) {
+	f.Add("1000,2,2700,100")
+	f.Add("100,2,2700,100,50,1,255,10,500,7,0,0,500,2,5000,1")
+	f.Add("50,1,16777215,-1")
+	f.Add("1000,3,0,0")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, expression string) {
+		flow, err := ParseFlow(expression)
+		if err != nil {
+			return
+		}
+
+		again, err := ParseFlow(flow.String())
+		if err != nil {
+			t.Fatalf("formatted flow %q is invalid: %v", flow.String(), err)
+		}
+
+		if !reflect.DeepEqual(flow, again) {
+			t.Fatalf("flow changed after formatting: %v != %v", flow, again)
+		}
+	})
+}
@@ -0,0 +1,291 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BrightnessCurve is the scale on which a fade progresses linearly
+type BrightnessCurve string
+
+// Brightness curves
+const (
+	LinearCurve BrightnessCurve = "linear" // device brightness
+	GammaCurve  BrightnessCurve = "gamma"  // light output raised to 1/2.2
+	CIECurve    BrightnessCurve = "cie"    // CIE L* lightness, close to the perception of the eye
+)
+
+// ErrFadeCancelled is returned when the light was changed by someone else during a fade.
+var ErrFadeCancelled = errors.New("Fade cancelled by a manual change on the light")
+
+var errInvalidFade = errors.New("Invalid fade")
+
+// Calibration describes how the light output follows the brightness setting.
+type Calibration struct {
+	Gamma float64 // light output is (brightness/100)^Gamma
+	Min   int     // lowest brightness at which the light is visibly on
+}
+
+// DefaultCalibration is used for the models missing from Calibrations, it assumes
+// a light output following the brightness setting linearly.
+var DefaultCalibration = Calibration{Gamma: 1, Min: 1}
+
+// Calibrations by model, matched on the longest prefix of the model so that
+// color4 uses color. The LEDs are dimmed by PWM, their output grows faster than
+// the brightness setting; the values are approximate, FadeOptions.Calibration
+// overrides them for a given light.
+var Calibrations = map[string]Calibration{
+	"mono":    {Gamma: 2, Min: 1},
+	"color":   {Gamma: 1.8, Min: 1},
+	"ct_bulb": {Gamma: 1.8, Min: 1},
+	"ceiling": {Gamma: 1.6, Min: 1},
+	"stripe":  {Gamma: 2.2, Min: 2},
+	"bslamp":  {Gamma: 2, Min: 1},
+}
+
+// CalibrationOf returns the calibration of a model, DefaultCalibration when unknown.
+func CalibrationOf(model string) Calibration {
+	cal, match := DefaultCalibration, ""
+	for prefix, c := range Calibrations {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(match) {
+			cal, match = c, prefix
+		}
+	}
+
+	return cal
+}
+
+// FadeOptions configures Fade.
+type FadeOptions struct {
+	To          int             // target brightness, 0 fades to the lowest brightness
+	Over        time.Duration   // duration of the fade
+	Curve       BrightnessCurve // scale on which the fade is linear, CIE L* by default
+	Step        time.Duration   // minimum time between two commands, 2s by default to stay under the quota
+	Then        string          // power state set at the end, "off" or "on", empty keeps it
+	Calibration *Calibration    // nil uses the calibration of the model
+}
+
+// perceived converts a light output (0-1) to the scale of the curve
+func (c BrightnessCurve) perceived(y float64) float64 {
+	switch c {
+	case LinearCurve:
+		return y
+	case GammaCurve:
+		return math.Pow(y, 1/2.2)
+	default:
+		if y > 0.008856 {
+			return (116*math.Cbrt(y) - 16) / 100
+		}
+		return 903.3 * y / 100
+	}
+}
+
+// output converts a value of the scale of the curve back to a light output (0-1)
+func (c BrightnessCurve) output(p float64) float64 {
+	switch c {
+	case LinearCurve:
+		return p
+	case GammaCurve:
+		return math.Pow(p, 2.2)
+	default:
+		if p > 0.08 {
+			return math.Pow((p*100+16)/116, 3)
+		}
+		return p * 100 / 903.3
+	}
+}
+
+// brightnessAt returns the device brightness at the given progress (0-1) of a fade
+func brightnessAt(from, to int, progress float64, curve BrightnessCurve, cal Calibration) int {
+	toOutput := func(b int) float64 { return math.Pow(float64(b)/100, cal.Gamma) }
+
+	p0, p1 := curve.perceived(toOutput(from)), curve.perceived(toOutput(to))
+	y := curve.output(p0 + (p1-p0)*progress)
+
+	return clamp(int(math.Round(100*math.Pow(y, 1/cal.Gamma))), cal.Min, 100)
+}
+
+// Fade changes the brightness of the light progressively over minutes or hours,
+// as a series of smooth steps following the curve. Failed steps are sent again at
+// the next step, so the fade goes on after the light is reconnected; it fails if
+// its last step cannot be sent. A change of the light not made by the fade, such
+// as someone setting the brightness, cancels it with ErrFadeCancelled.
+func Fade(ctx context.Context, y *Yeelight, opts FadeOptions) error {
+	if opts.To < 0 || opts.To > 100 || opts.Over <= 0 {
+		return fmt.Errorf("%w: target brightness must be between 0 and 100 and duration positive", errInvalidFade)
+	}
+	if opts.Then != "" && opts.Then != "on" && opts.Then != "off" {
+		return fmt.Errorf("%w: final power state must be on or off", errInvalidFade)
+	}
+	if opts.Curve == "" {
+		opts.Curve = CIECurve
+	}
+	if opts.Step <= 0 {
+		opts.Step = 2 * time.Second
+	}
+
+	cal := CalibrationOf(y.Model)
+	if opts.Calibration != nil {
+		cal = *opts.Calibration
+	}
+	target := clamp(opts.To, cal.Min, 100)
+
+	state := *y
+	if err := state.getProp(ctx); err != nil {
+		return err
+	}
+
+	from := state.Bright
+	if state.Power != "on" {
+		// start from the lowest brightness instead of the last one
+		from = cal.Min
+		if err := turnOnAt(ctx, y, state, from); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	w := &fadeWatcher{bright: from, power: "on"}
+	go w.watch(ctx, y, cancel)
+
+	start := time.Now()
+	for {
+		progress := math.Min(1, float64(time.Since(start))/float64(opts.Over))
+		bright := brightnessAt(from, target, progress, opts.Curve, cal)
+
+		// a failed step is only expected once sent, so that it is retried at the next one
+		if bright != w.expected() {
+			w.send(bright)
+			_, err := y.Call(ctx, "set_bright", bright, "smooth", int(opts.Step.Milliseconds()))
+			w.sent(bright, err == nil)
+			if err != nil && ctx.Err() == nil && (!Retryable(err) || progress >= 1) {
+				return err
+			}
+		}
+
+		if progress >= 1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(opts.Step):
+		}
+	}
+
+	if opts.Then != "" {
+		w.expectPower(opts.Then)
+		if _, err := y.Call(ctx, "set_power", opts.Then, "smooth", int(opts.Step.Milliseconds())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// turnOnAt turns on a light directly at the given brightness when it supports scenes
+func turnOnAt(ctx context.Context, y *Yeelight, state Yeelight, bright int) error {
+	if capabilities(y) != capMono {
+		ct := clamp(state.ColorTemp, minColorTemp, maxColorTemp)
+		if _, err := y.Call(ctx, "set_scene", "ct", ct, bright); err == nil {
+			return nil
+		}
+	}
+
+	if _, err := y.Call(ctx, "set_power", "on", "sudden", 0); err != nil {
+		return err
+	}
+
+	_, err := y.Call(ctx, "set_bright", bright, "sudden", 0)
+	return err
+}
+
+// fadeWatcher cancels a fade when the light reports a state the fade did not set
+type fadeWatcher struct {
+	mu      sync.Mutex
+	bright  int // last brightness set by the fade
+	sending int // brightness being sent, whose notification may come before the reply
+	power   string
+}
+
+func (w *fadeWatcher) expected() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.bright
+}
+
+func (w *fadeWatcher) send(bright int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sending = bright
+}
+
+func (w *fadeWatcher) sent(bright int, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if ok {
+		w.bright = bright
+	}
+	w.sending = 0
+}
+
+func (w *fadeWatcher) expectPower(power string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.power = power
+}
+
+// watch listens to the notifications of the light until the fade ends
+func (w *fadeWatcher) watch(ctx context.Context, y *Yeelight, cancel context.CancelCauseFunc) {
+	for ctx.Err() == nil {
+		y.Listen(ctx, func(n Notification) {
+			if n.Method != "props" || !w.manual(n.Params) {
+				return
+			}
+			cancel(ErrFadeCancelled)
+		})
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// manual reports whether the notified properties were changed by someone else
+func (w *fadeWatcher) manual(props map[string]string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if power, ok := props["power"]; ok && power != w.power {
+		return true
+	}
+
+	if value, ok := props["bright"]; ok {
+		bright, err := strconv.Atoi(value)
+		if err == nil && bright != w.bright && bright != w.sending {
+			return true
+		}
+	}
+
+	for _, prop := range []string{"ct", "rgb", "hue", "sat"} {
+		if _, ok := props[prop]; ok {
+			return true
+		}
+	}
+
+	return false
+}
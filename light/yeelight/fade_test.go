@@ -0,0 +1,83 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dimmer answers get_prop with a light on at 50%, and fails the set_bright listed in fail
+type dimmer struct {
+	mu   sync.Mutex
+	fail func(call int) bool
+	call int
+	set  []int
+}
+
+func (d *dimmer) middleware(next Handler) Handler {
+	return func(ctx context.Context, ex *Exchange) error {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		switch ex.Command.Method {
+		case "get_prop":
+			ex.Response = Response{Result: []interface{}{"on", "50", "4000", "0", "0", "0", "2", ""}}
+		case "set_bright":
+			d.call++
+			if d.fail(d.call) {
+				return fmt.Errorf("%w: %s", errResolveTCP, ex.Light.Location)
+			}
+			d.set = append(d.set, ex.Command.Params.([]interface{})[0].(int))
+			ex.Response = Response{Result: []interface{}{"ok"}}
+		default:
+			return fmt.Errorf("unexpected %s", ex.Command.Method)
+		}
+		return nil
+	}
+}
+
+func fadeLight(d *dimmer) *Yeelight {
+	// nothing listens on the port, the notifications of the light are not read
+	return NewClient(WithMiddleware(d.middleware)).Bind(&Yeelight{Location: "127.0.0.1:1"})
+}
+
+func TestFadeRetriesFailedStep(t *testing.T) {
+	// 49 is reached before the end of the fade, its step fails and is sent again at the end
+	d := &dimmer{fail: func(call int) bool { return call == 1 }}
+	opts := FadeOptions{To: 49, Over: 200 * time.Millisecond, Step: 70 * time.Millisecond, Curve: LinearCurve}
+
+	if err := Fade(context.Background(), fadeLight(d), opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{49}; !reflect.DeepEqual(d.set, want) {
+		t.Fatalf("got %v, want %v", d.set, want)
+	}
+}
+
+func TestFadeLastStepFails(t *testing.T) {
+	d := &dimmer{fail: func(int) bool { return true }}
+	opts := FadeOptions{To: 40, Over: 50 * time.Millisecond, Step: 100 * time.Millisecond, Curve: LinearCurve}
+
+	if err := Fade(context.Background(), fadeLight(d), opts); !errors.Is(err, errResolveTCP) {
+		t.Fatalf("got %v, want the error of the last step", err)
+	}
+}
+
+func TestCalibrationOf(t *testing.T) {
+	for model, want := range map[string]Calibration{
+		"color4":   Calibrations["color"],
+		"mono1":    Calibrations["mono"],
+		"ceiling4": Calibrations["ceiling"],
+		"stripe":   Calibrations["stripe"],
+		"unknown":  DefaultCalibration,
+		"":         DefaultCalibration,
+	} {
+		if got := CalibrationOf(model); got != want {
+			t.Errorf("%q: got %+v, want %+v", model, got, want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package yeelight
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// capability is what a light can render
+type capability int
+
+const (
+	capUnknown     capability = iota
+	capMono                   // brightness only
+	capTemperature            // brightness and color temperature
+	capColor                  // brightness, color temperature and colors
+)
+
+// monoColorTemp is sent in the flows of mono lights, which ignore it
+const monoColorTemp = 2700
+
+// capabilities guesses what the light can render from its supported methods or its model
+func capabilities(y *Yeelight) capability {
+	if len(y.Support) > 0 {
+		supported := make(map[string]bool, len(y.Support))
+		for _, method := range y.Support {
+			supported[method] = true
+		}
+
+		switch {
+		case supported["set_rgb"] || supported["set_hsv"]:
+			return capColor
+		case supported["set_ct_abx"]:
+			return capTemperature
+		case supported["set_bright"]:
+			return capMono
+		}
+	}
+
+	model := strings.ToLower(y.Model)
+	switch {
+	case strings.HasPrefix(model, "mono"):
+		return capMono
+	case strings.HasPrefix(model, "ct"), strings.HasPrefix(model, "ceiling"), strings.HasPrefix(model, "lamp"):
+		return capTemperature
+	case strings.HasPrefix(model, "color"), strings.HasPrefix(model, "stripe"), strings.HasPrefix(model, "bslamp"):
+		return capColor
+	}
+
+	return capUnknown
+}
+
+// Supports reports whether the light supports a method, from its Support or,
+// for the lights which did not advertise it, guessed from their Model.
+// The methods of lights of unknown model are assumed supported.
+func (y *Yeelight) Supports(method string) bool {
+	for _, m := range y.Support {
+		if m == method {
+			return true
+		}
+	}
+	if len(y.Support) > 0 {
+		return false
+	}
+
+	switch c := capabilities(y); method {
+	case "set_rgb", "set_hsv":
+		return c == capColor || c == capUnknown
+	case "set_ct_abx":
+		return c >= capTemperature || c == capUnknown
+	default:
+		return true
+	}
+}
+
+// Fallback translates the commands a light cannot render into the nearest ones it
+// supports, based on its Support and Model: colors become the nearest color
+// temperature and perceived brightness on color temperature lights, and the
+// perceived brightness only on mono lights. Color flows are rewritten the same way.
+// Lights with unknown capabilities receive the commands unchanged.
+func Fallback() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, ex *Exchange) error {
+			cmds, translated := translate(capabilities(ex.Light), ex.Command)
+			if !translated {
+				return next(ctx, ex)
+			}
+
+			if len(cmds) == 0 {
+				// nothing the light can render, acknowledge without sending
+				ex.Response = Response{ID: ex.Command.ID, Result: []interface{}{"ok"}}
+				return nil
+			}
+
+			for _, cmd := range cmds {
+				ex.Command = cmd
+				if err := next(ctx, ex); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+	}
+}
+
+// translate returns the commands to send instead of cmd, and whether it had to be translated
+func translate(capa capability, cmd Command) ([]Command, bool) {
+	if capa == capUnknown || capa == capColor {
+		return nil, false
+	}
+
+	params, _ := cmd.Params.([]interface{})
+	with := func(method string, params ...interface{}) Command {
+		return Command{ID: cmd.ID, Method: method, Params: params}
+	}
+
+	switch cmd.Method {
+	case "set_rgb", "set_hsv":
+		var rgb int
+		var rest []interface{}
+		switch {
+		case cmd.Method == "set_rgb" && len(params) >= 1:
+			v, ok := toInt(params[0])
+			if !ok {
+				return nil, false
+			}
+			rgb, rest = v, params[1:]
+		case cmd.Method == "set_hsv" && len(params) >= 2:
+			hue, ok1 := toInt(params[0])
+			sat, ok2 := toInt(params[1])
+			if !ok1 || !ok2 {
+				return nil, false
+			}
+			rgb, rest = HSVToRGB(float64(hue), float64(sat)), params[2:]
+		default:
+			return nil, false
+		}
+
+		bright := with("set_bright", append([]interface{}{perceivedBrightness(rgb)}, rest...)...)
+		if capa == capMono {
+			return []Command{bright}, true
+		}
+
+		ct := with("set_ct_abx", append([]interface{}{rgbToColorTemp(rgb)}, rest...)...)
+		return []Command{ct, bright}, true
+
+	case "set_ct_abx":
+		if capa == capMono {
+			return nil, true
+		}
+
+	case "start_cf":
+		if len(params) < 3 {
+			return nil, false
+		}
+
+		expression, _ := params[2].(string)
+		flow, err := ParseFlow(expression)
+		if err != nil {
+			return nil, false
+		}
+
+		for i, t := range flow {
+			flow[i] = translateTuple(capa, t)
+		}
+
+		return []Command{with("start_cf", params[0], params[1], flow.String())}, true
+	}
+
+	return nil, false
+}
+
+// translateTuple rewrites a flow tuple for a light without colors
+func translateTuple(capa capability, t FlowTuple) FlowTuple {
+	switch t.Mode {
+	case FlowColor:
+		bright := perceivedBrightness(t.Value)
+		if t.Brightness > 0 {
+			bright = clamp(bright*t.Brightness/100, 1, 100)
+		}
+
+		t.Mode, t.Brightness = FlowTemperature, bright
+		if capa == capMono {
+			t.Value = monoColorTemp
+		} else {
+			t.Value = rgbToColorTemp(t.Value)
+		}
+	case FlowTemperature:
+		if capa == capMono {
+			t.Value = monoColorTemp
+		}
+	}
+
+	return t
+}
+
+// toInt converts a parameter set by the setters (int), decoded from JSON (float64),
+// or by the daemon which keeps the numbers as written (json.Number)
+func toInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return int(f), err == nil
+	}
+
+	return 0, false
+}
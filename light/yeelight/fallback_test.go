@@ -0,0 +1,48 @@
+package yeelight
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	red := rgbToColorTemp(0xff0000)
+	for _, test := range []struct {
+		name       string
+		capa       capability
+		cmd        Command
+		want       []string
+		translated bool
+	}{
+		{"color light", capColor, Command{Method: "set_rgb", Params: []interface{}{0xff0000, "smooth", 500}}, nil, false},
+		{"unknown light", capUnknown, Command{Method: "set_rgb", Params: []interface{}{0xff0000}}, nil, false},
+		{"rgb on temperature", capTemperature, Command{Method: "set_rgb", Params: []interface{}{0xff0000, "smooth", 500}},
+			[]string{fmt.Sprint("set_ct_abx[", red, " smooth 500]"), "set_bright[53 smooth 500]"}, true},
+		{"decoded rgb on mono", capMono, Command{Method: "set_rgb", Params: []interface{}{float64(0xffffff)}},
+			[]string{"set_bright[100]"}, true},
+		{"daemon hsv on mono", capMono, Command{Method: "set_hsv", Params: []interface{}{json.Number("240"), json.Number("100"), "sudden", json.Number("0")}},
+			[]string{"set_bright[32 sudden 0]"}, true},
+		{"temperature on mono", capMono, Command{Method: "set_ct_abx", Params: []interface{}{2700, "smooth", 500}}, []string{}, true},
+		{"temperature on temperature", capTemperature, Command{Method: "set_ct_abx", Params: []interface{}{2700}}, nil, false},
+		{"invalid rgb", capMono, Command{Method: "set_rgb", Params: []interface{}{"red"}}, nil, false},
+		{"flow on mono", capMono, Command{Method: "start_cf", Params: []interface{}{0, 0, "1000,1,16711680,100,500,2,4000,50,300,7,0,0"}},
+			[]string{"start_cf[0 0 1000,2,2700,53,500,2,2700,50,300,7,0,0]"}, true},
+		{"flow on temperature", capTemperature, Command{Method: "start_cf", Params: []interface{}{0, 0, "1000,1,16777215,50"}},
+			[]string{"start_cf[0 0 1000,2,6500,50]"}, true},
+	} {
+		cmds, translated := translate(test.capa, test.cmd)
+		got := []string{}
+		for _, cmd := range cmds {
+			got = append(got, fmt.Sprint(cmd.Method, cmd.Params))
+		}
+		if test.want == nil {
+			test.want = []string{}
+		}
+
+		if translated != test.translated || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, %t, want %v, %t", test.name, got, translated, test.want, test.translated)
+		}
+	}
+}
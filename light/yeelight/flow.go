@@ -0,0 +1,116 @@
+package yeelight
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FlowMode is the kind of state change of a flow tuple
+type FlowMode int
+
+// Flow modes supported by the lights
+const (
+	FlowColor       FlowMode = 1
+	FlowTemperature FlowMode = 2
+	FlowSleep       FlowMode = 7
+)
+
+// maxFlowDuration is the longest duration of a tuple, in milliseconds
+const maxFlowDuration = 1<<31 - 1
+
+var errInvalidFlow = errors.New("Invalid flow expression")
+
+// FlowTuple is a visible state change of a color flow.
+type FlowTuple struct {
+	Duration   time.Duration // at least 50ms
+	Mode       FlowMode
+	Value      int // RGB color or color temperature, ignored when sleeping
+	Brightness int // 1 to 100, -1 keeps the current brightness
+}
+
+// Flow is a series of flow tuples, as expected by StartCf.
+type Flow []FlowTuple
+
+// ParseFlow parses and validates a flow expression such as "1000,2,2700,100,500,1,255,10".
+// Durations of the expression are in milliseconds.
+func ParseFlow(expression string) (Flow, error) {
+	fields := strings.Split(expression, ",")
+	if len(fields)%4 != 0 {
+		return nil, fmt.Errorf("%w: it must be a series of [duration, mode, value, brightness]", errInvalidFlow)
+	}
+
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not an integer", errInvalidFlow, field)
+		}
+		values[i] = v
+	}
+
+	flow := make(Flow, 0, len(values)/4)
+	for i := 0; i < len(values); i += 4 {
+		if values[i] < 0 || values[i] > maxFlowDuration {
+			return nil, fmt.Errorf("%w: duration %dms out of range", errInvalidFlow, values[i])
+		}
+
+		tuple := FlowTuple{
+			Duration:   time.Duration(values[i]) * time.Millisecond,
+			Mode:       FlowMode(values[i+1]),
+			Value:      values[i+2],
+			Brightness: values[i+3],
+		}
+
+		if err := tuple.validate(); err != nil {
+			return nil, err
+		}
+		flow = append(flow, tuple)
+	}
+
+	return flow, nil
+}
+
+func (t FlowTuple) validate() error {
+	if t.Duration < 50*time.Millisecond || t.Duration > maxFlowDuration*time.Millisecond {
+		return fmt.Errorf("%w: duration %v out of range", errInvalidFlow, t.Duration)
+	}
+
+	switch t.Mode {
+	case FlowColor:
+		if t.Value < 0 || t.Value > 0xffffff {
+			return fmt.Errorf("%w: color %d out of range", errInvalidFlow, t.Value)
+		}
+	case FlowTemperature:
+		if t.Value < 1700 || t.Value > 6500 {
+			return fmt.Errorf("%w: color temperature %d out of range", errInvalidFlow, t.Value)
+		}
+	case FlowSleep:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown mode %d", errInvalidFlow, t.Mode)
+	}
+
+	if t.Brightness != -1 && (t.Brightness < 1 || t.Brightness > 100) {
+		return fmt.Errorf("%w: brightness %d out of range", errInvalidFlow, t.Brightness)
+	}
+
+	return nil
+}
+
+// String formats the flow as an expression accepted by StartCf.
+func (f Flow) String() string {
+	fields := make([]string, 0, len(f)*4)
+	for _, t := range f {
+		fields = append(fields,
+			strconv.FormatInt(t.Duration.Milliseconds(), 10),
+			strconv.Itoa(int(t.Mode)),
+			strconv.Itoa(t.Value),
+			strconv.Itoa(t.Brightness),
+		)
+	}
+
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,264 @@
+package yeelight
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Notification is sent by a light to every open connection when its state changes.
+type Notification struct {
+	Method string            `json:"method"`
+	Params map[string]string `json:"params"`
+}
+
+// Listen keeps a connection open to the light and calls fn for every
+// notification received, until the context is cancelled or the connection is lost.
+func (y *Yeelight) Listen(ctx context.Context, fn func(Notification)) error {
+	conn, err := y.clientOrDefault().dial(ctx, y.Location)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: %w", errConnectLight, err)
+		}
+
+		n, err := decodeNotification(bytes.TrimSpace(data))
+		if err != nil {
+			continue
+		}
+		fn(n)
+	}
+}
+
+// LiveLight is a light whose state is cached and kept current from the
+// notifications of the light and the results of the commands sent through it.
+// It is safe for concurrent use.
+type LiveLight struct {
+	mu      sync.Mutex
+	state   Yeelight
+	updated time.Time
+	changed chan struct{} // closed on every update
+}
+
+// NewLiveLight returns a live light starting from the given state.
+// Call Run to keep it current.
+func NewLiveLight(y Yeelight) *LiveLight {
+	y.live = nil
+	return &LiveLight{state: y, changed: make(chan struct{})}
+}
+
+// Light returns a light sending its commands through the live light, so that
+// their results update the cached state. Each call returns a new value.
+func (l *LiveLight) Light() *Yeelight {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	y := l.state
+	y.Support = append([]string(nil), l.state.Support...)
+	y.live = l
+	return &y
+}
+
+// State returns a copy of the cached state and the time it was last updated.
+func (l *LiveLight) State() (Yeelight, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	y := l.state
+	y.Support = append([]string(nil), l.state.Support...)
+	return y, l.updated
+}
+
+// Age returns how long ago the cached state was updated, ok is false when the
+// state was never read from the light.
+func (l *LiveLight) Age() (age time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.updated.IsZero() {
+		return 0, false
+	}
+
+	return time.Since(l.updated), true
+}
+
+// Call sends a method to the light and applies its result to the cached state.
+func (l *LiveLight) Call(ctx context.Context, method string, params ...interface{}) (Response, error) {
+	return l.Light().Call(ctx, method, params...)
+}
+
+// Refresh reads the state of the light.
+func (l *LiveLight) Refresh(ctx context.Context) error {
+	return l.Light().getProp(ctx)
+}
+
+// Run keeps the cached state current until the context is cancelled. The state is
+// read when connecting, then updated from notifications. Lost connections are
+// reopened after retryDelay.
+func (l *LiveLight) Run(ctx context.Context, retryDelay time.Duration) error {
+	for {
+		err := l.Refresh(ctx)
+		if err == nil {
+			err = l.Light().Listen(ctx, func(n Notification) {
+				if n.Method == "props" {
+					l.Update(n.Params)
+				}
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// Update applies property values to the cached state and wakes up the waiters.
+func (l *LiveLight) Update(props map[string]string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.state
+	for name, value := range props {
+		if err := state.setProp(name, value); err != nil {
+			// keep the properties we could not parse unchanged
+			continue
+		}
+	}
+
+	l.state = state
+	l.updated = time.Now()
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Wait blocks until the cached state satisfies the predicate, and returns it.
+func (l *LiveLight) Wait(ctx context.Context, predicate func(Yeelight) bool) (Yeelight, error) {
+	for {
+		l.mu.Lock()
+		state, changed := l.state, l.changed
+		l.mu.Unlock()
+
+		if predicate(state) {
+			return state, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return state, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// applyCommand updates the cached state after the light acknowledged a command,
+// before is the state when the command was sent.
+func (l *LiveLight) applyCommand(before Yeelight, cmd Command, resp Response) {
+	var params []string
+	switch p := cmd.Params.(type) {
+	case []string:
+		params = p
+	case []interface{}:
+		for _, v := range p {
+			params = append(params, formatParam(v))
+		}
+	}
+
+	param := func(i int) string {
+		if i >= len(params) {
+			return ""
+		}
+		return params[i]
+	}
+
+	props := make(map[string]string)
+	switch cmd.Method {
+	case "get_prop":
+		values, err := resp.Strings()
+		if err != nil {
+			return
+		}
+		for i, value := range values {
+			props[param(i)] = value
+		}
+	case "set_power":
+		props["power"] = param(0)
+	case "toggle":
+		props["power"] = map[string]string{"on": "off", "off": "on"}[before.Power]
+	case "set_bright":
+		props["bright"] = param(0)
+	case "set_ct_abx":
+		props["ct"], props["color_mode"] = param(0), "2"
+	case "set_rgb":
+		props["rgb"], props["color_mode"] = param(0), "1"
+	case "set_hsv":
+		props["hue"], props["sat"], props["color_mode"] = param(0), param(1), "3"
+	case "set_name":
+		props["name"] = param(0)
+	default:
+		return
+	}
+
+	l.Update(props)
+}
+
+// decodeNotification parses a notification sent by a light.
+func decodeNotification(data []byte) (Notification, error) {
+	var raw struct {
+		Method string                 `json:"method"`
+		Params map[string]interface{} `json:"params"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil || raw.Method == "" {
+		return Notification{}, errInvalidResponse
+	}
+
+	n := Notification{Method: raw.Method, Params: make(map[string]string, len(raw.Params))}
+	for name, value := range raw.Params {
+		switch value := value.(type) {
+		case string:
+			n.Params[name] = value
+		case float64:
+			n.Params[name] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+
+	return n, nil
+}
+
+// formatParam formats a parameter as the light would report it, the numbers
+// decoded by encoding/json are float64, or json.Number kept as written by the
+// daemon, and must not use the exponent notation
+func formatParam(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return n.String()
+	case float32:
+		return strconv.FormatFloat(float64(n), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
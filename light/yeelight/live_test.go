@@ -0,0 +1,62 @@
+package yeelight
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestApplyCommandDecodedParams(t *testing.T) {
+	// the params decoded by encoding/json are float64, the daemon keeps them as
+	// written with UseNumber
+	decoded := func(data string, useNumber bool) []interface{} {
+		decoder := json.NewDecoder(strings.NewReader(data))
+		if useNumber {
+			decoder.UseNumber()
+		}
+
+		var params []interface{}
+		if err := decoder.Decode(&params); err != nil {
+			t.Fatal(err)
+		}
+		return params
+	}
+
+	for _, params := range [][]interface{}{
+		decoded(`[16711680, "smooth", 500]`, false),
+		decoded(`[16711680, "smooth", 500]`, true),
+		decoded(`[1.671168e7, "smooth", 500]`, true),
+	} {
+		live := NewLiveLight(Yeelight{Location: "127.0.0.1:55443"})
+		live.applyCommand(Yeelight{}, Command{Method: "set_rgb", Params: params}, Response{})
+
+		state, _ := live.State()
+		if state.RGB != 16711680 || state.ColorMode != 1 {
+			t.Errorf("%T params: got rgb %d and color mode %d, want 16711680 and 1", params[0], state.RGB, state.ColorMode)
+		}
+	}
+}
+
+func TestApplyCommandToggle(t *testing.T) {
+	live := NewLiveLight(Yeelight{Location: "127.0.0.1:55443", Power: "on"})
+
+	// the notification of the change arrived before the response
+	live.Update(map[string]string{"power": "off"})
+	live.applyCommand(Yeelight{Power: "on"}, Command{Method: "toggle"}, Response{})
+
+	if state, _ := live.State(); state.Power != "off" {
+		t.Fatalf("got power %q, want off", state.Power)
+	}
+}
+
+func TestAge(t *testing.T) {
+	live := NewLiveLight(Yeelight{Location: "127.0.0.1:55443"})
+	if _, ok := live.Age(); ok {
+		t.Fatal("a state never read has an age")
+	}
+
+	live.Update(map[string]string{"power": "on"})
+	if _, ok := live.Age(); !ok {
+		t.Fatal("an updated state has no age")
+	}
+}
@@ -0,0 +1,85 @@
+package yeelight
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Exchange describes a command sent to a light together with its outcome.
+// Middlewares receive the exchange before it is sent and can inspect it
+// once the next handler returned.
+type Exchange struct {
+	Light    *Yeelight
+	Command  Command
+	Request  []byte // raw JSON sent to the light
+	Reply    []byte // raw JSON received from the light
+	Response Response
+	Duration time.Duration // time spent talking to the light
+}
+
+// Handler sends the command of an exchange and fills in the result.
+type Handler func(ctx context.Context, ex *Exchange) error
+
+// Middleware wraps a Handler, for logging, tracing or altering exchanges.
+type Middleware func(next Handler) Handler
+
+// Use appends middlewares to the chain of the default client.
+func Use(mw ...Middleware) {
+	DefaultClient.Use(mw...)
+}
+
+// SetRetryPolicy changes how failed requests of the default client are retried.
+// Requests are not retried by default.
+func SetRetryPolicy(p RetryPolicy) {
+	DefaultClient.SetRetryPolicy(p)
+}
+
+// chain wraps h with the given middlewares, the first one being the outermost.
+func chain(h Handler, mw []Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// WireLogger logs every exchange with the raw JSON sent and received.
+// Successful exchanges are logged at debug level, failed ones as warnings.
+func WireLogger(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, ex *Exchange) error {
+			err := next(ctx, ex)
+
+			attrs := []slog.Attr{
+				slog.String("location", ex.Light.Location),
+				slog.String("method", ex.Command.Method),
+				slog.String("request", string(ex.Request)),
+				slog.String("reply", string(ex.Reply)),
+				slog.Duration("duration", ex.Duration),
+			}
+
+			level := slog.LevelDebug
+			if err != nil {
+				level = slog.LevelWarn
+				attrs = append(attrs, slog.Any("error", err))
+			}
+
+			logger.LogAttrs(ctx, level, "yeelight exchange", attrs...)
+			return err
+		}
+	}
+}
+
+// Timing reports how long each exchange took, including the time spent in
+// the middlewares placed after it.
+func Timing(observe func(ex *Exchange, elapsed time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, ex *Exchange) error {
+			start := time.Now()
+			err := next(ctx, ex)
+			observe(ex, time.Since(start), err)
+			return err
+		}
+	}
+}
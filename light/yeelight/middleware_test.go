@@ -0,0 +1,121 @@
+package yeelight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// observed is an exchange as seen by Timing
+type observed struct {
+	method   string
+	duration time.Duration // spent talking to the light
+	elapsed  time.Duration // spent in the chain
+	err      error
+}
+
+// timedClient returns a light of a client logging the exchanges, timing them
+// and adding delay after the timing
+func timedClient(light *flakyLight, delay time.Duration) (*Yeelight, *bytes.Buffer, *[]observed) {
+	var logs bytes.Buffer
+	var seen []observed
+
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := NewClient(
+		WithDialer(light),
+		WithReadTimeout(time.Second),
+		WithLogger(logger),
+		WithMiddleware(
+			Timing(func(ex *Exchange, elapsed time.Duration, err error) {
+				seen = append(seen, observed{ex.Command.Method, ex.Duration, elapsed, err})
+			}),
+			func(next Handler) Handler {
+				return func(ctx context.Context, ex *Exchange) error {
+					time.Sleep(delay)
+					return next(ctx, ex)
+				}
+			},
+		),
+	)
+
+	return client.Bind(&Yeelight{Location: "127.0.0.1:55443"}), &logs, &seen
+}
+
+// records decodes the JSON log records
+func records(t *testing.T, logs *bytes.Buffer) []map[string]interface{} {
+	var recs []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		rec := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid log record %q: %v", line, err)
+		}
+		recs = append(recs, rec)
+	}
+
+	return recs
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	light, logs, seen := timedClient(&flakyLight{}, 20*time.Millisecond)
+	if _, err := light.SetPower("on", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*seen) != 1 {
+		t.Fatalf("got %d exchanges observed, want 1", len(*seen))
+	}
+	ex := (*seen)[0]
+	if ex.method != "set_power" || ex.err != nil {
+		t.Errorf("observed %s with %v", ex.method, ex.err)
+	}
+	// the timing includes the middlewares after it, the duration only the light
+	if ex.duration <= 0 || ex.elapsed < ex.duration+20*time.Millisecond {
+		t.Errorf("got elapsed %v for a duration of %v and a delay of 20ms", ex.elapsed, ex.duration)
+	}
+
+	recs := records(t, logs)
+	if len(recs) != 1 {
+		t.Fatalf("got %d log records, want 1", len(recs))
+	}
+	rec := recs[0]
+	if rec["level"] != "DEBUG" || rec["msg"] != "yeelight exchange" || rec["method"] != "set_power" || rec["location"] != "127.0.0.1:55443" {
+		t.Errorf("got record %v", rec)
+	}
+	if request, _ := rec["request"].(string); !strings.Contains(request, `"method":"set_power"`) || !strings.Contains(request, `"params":["on","sudden",0]`) {
+		t.Errorf("got request %q", rec["request"])
+	}
+	if reply, _ := rec["reply"].(string); !strings.Contains(reply, `"result":["ok"]`) {
+		t.Errorf("got reply %q", rec["reply"])
+	}
+	// the logger sits after the timing, it logs the time spent talking to the light
+	if d, _ := rec["duration"].(float64); time.Duration(d) != ex.duration {
+		t.Errorf("logged duration %v, want %v", time.Duration(d), ex.duration)
+	}
+	if _, ok := rec["error"]; ok {
+		t.Errorf("error logged for a success: %v", rec["error"])
+	}
+}
+
+func TestMiddlewareChainError(t *testing.T) {
+	light, logs, seen := timedClient(&flakyLight{script: []string{"drop"}}, 0)
+	_, err := light.SetPower("on", 0)
+	if err == nil {
+		t.Fatal("no error from a dropped connection")
+	}
+
+	if len(*seen) != 1 || (*seen)[0].err == nil {
+		t.Fatalf("got %+v observed, want the error", *seen)
+	}
+
+	recs := records(t, logs)
+	if len(recs) != 1 {
+		t.Fatalf("got %d log records, want 1", len(recs))
+	}
+	if recs[0]["level"] != "WARN" || recs[0]["error"] == nil || recs[0]["reply"] != "" {
+		t.Errorf("got record %v", recs[0])
+	}
+}
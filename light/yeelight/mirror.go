@@ -0,0 +1,138 @@
+package yeelight
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// MirrorTarget is a light copying the state of the mirrored light.
+type MirrorTarget struct {
+	Light            *Yeelight
+	BrightnessOffset int               // added to the brightness of the source
+	Color            func(rgb int) int // maps the colors of the source, nil copies them
+}
+
+// MirrorOptions configures Mirror.
+type MirrorOptions struct {
+	Host       string        // local address given to the lights for music mode, found automatically when empty
+	Duration   time.Duration // duration of the transitions on the targets
+	RetryDelay time.Duration // delay before reconnecting to the source
+}
+
+// Mirror copies the power, brightness and color of the source light to the
+// targets in real time, from the notifications of the source, until the context
+// is cancelled. Commands go through music mode when the targets support it.
+func Mirror(ctx context.Context, source *Yeelight, targets []MirrorTarget, opts MirrorOptions) error {
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 5 * time.Second
+	}
+
+	senders := make([]*Sender, len(targets))
+	for i, target := range targets {
+		senders[i] = NewSender(target.Light, opts.Host)
+		defer senders[i].Close()
+	}
+
+	live := NewLiveLight(*source)
+	apply := func(props map[string]string) {
+		live.Update(props)
+		state, _ := live.State()
+		for i, target := range targets {
+			for _, cmd := range mirrorCommands(state, props, target, opts.Duration) {
+				senders[i].Send(ctx, cmd.Method, cmd.Params.([]interface{})...)
+			}
+		}
+	}
+
+	for {
+		err := live.Refresh(ctx)
+		if err == nil {
+			// copy the whole state, then the changes
+			state, _ := live.State()
+			apply(stateProps(state))
+
+			err = live.Light().Listen(ctx, func(n Notification) {
+				if n.Method == "props" {
+					apply(n.Params)
+				}
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.RetryDelay):
+		}
+	}
+}
+
+// stateProps returns the properties copied by Mirror
+func stateProps(y Yeelight) map[string]string {
+	return map[string]string{
+		"power":      y.Power,
+		"bright":     strconv.Itoa(y.Bright),
+		"color_mode": strconv.Itoa(y.ColorMode),
+	}
+}
+
+// mirrorCommands returns the commands reproducing the changed properties on a target,
+// within what the target supports
+func mirrorCommands(state Yeelight, changed map[string]string, target MirrorTarget, duration time.Duration) []Command {
+	effect, ms := "sudden", 0
+	if duration > 0 {
+		effect, ms = "smooth", int(duration.Milliseconds())
+	}
+
+	var cmds []Command
+	add := func(method string, params ...interface{}) {
+		cmds = append(cmds, Command{Method: method, Params: params})
+	}
+
+	if _, ok := changed["power"]; ok && (state.Power == "on" || state.Power == "off") {
+		add("set_power", state.Power, effect, ms)
+	}
+
+	if _, ok := changed["bright"]; ok && state.Bright > 0 {
+		add("set_bright", clamp(state.Bright+target.BrightnessOffset, 1, 100), effect, ms)
+	}
+
+	_, mode := changed["color_mode"]
+	_, rgb := changed["rgb"]
+	_, ct := changed["ct"]
+	_, hue := changed["hue"]
+	_, sat := changed["sat"]
+
+	var color int
+	switch {
+	case state.ColorMode == 1 && (mode || rgb):
+		color = state.RGB
+	case state.ColorMode == 3 && (mode || hue || sat):
+		color = HSVToRGB(float64(state.Hue), float64(state.Saturation))
+	case state.ColorMode == 2 && (mode || ct):
+		if target.Color == nil || !target.Light.Supports("set_rgb") {
+			if target.Light.Supports("set_ct_abx") {
+				add("set_ct_abx", clamp(state.ColorTemp, minColorTemp, maxColorTemp), effect, ms)
+			}
+			return cmds
+		}
+		color = colorTempToRGB(state.ColorTemp)
+	default:
+		return cmds
+	}
+
+	if target.Color != nil {
+		color = target.Color(color)
+	}
+
+	// the targets without colors get the nearest color temperature, the mono
+	// ones only the brightness copied above
+	switch {
+	case target.Light.Supports("set_rgb"):
+		add("set_rgb", color, effect, ms)
+	case target.Light.Supports("set_ct_abx"):
+		add("set_ct_abx", rgbToColorTemp(color), effect, ms)
+	}
+
+	return cmds
+}
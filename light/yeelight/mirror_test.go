@@ -0,0 +1,69 @@
+package yeelight
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMirrorCommands(t *testing.T) {
+	color := &Yeelight{Model: "color"}
+	temperature := &Yeelight{Model: "ct_bulb"}
+	mono := &Yeelight{Support: []string{"set_power", "set_bright"}}
+	red := rgbToColorTemp(0xff0000)
+
+	for _, test := range []struct {
+		name     string
+		state    Yeelight
+		changed  []string
+		target   MirrorTarget
+		duration time.Duration
+		want     []string
+	}{
+		{"power", Yeelight{Power: "on"}, []string{"power"}, MirrorTarget{Light: mono}, 0,
+			[]string{"set_power[on sudden 0]"}},
+		{"smooth power", Yeelight{Power: "off"}, []string{"power"}, MirrorTarget{Light: mono}, 500 * time.Millisecond,
+			[]string{"set_power[off smooth 500]"}},
+		{"brightness", Yeelight{Bright: 50}, []string{"bright"}, MirrorTarget{Light: mono, BrightnessOffset: 10}, 0,
+			[]string{"set_bright[60 sudden 0]"}},
+		{"brightness above 100", Yeelight{Bright: 90}, []string{"bright"}, MirrorTarget{Light: mono, BrightnessOffset: 20}, 0,
+			[]string{"set_bright[100 sudden 0]"}},
+		{"brightness below 1", Yeelight{Bright: 10}, []string{"bright"}, MirrorTarget{Light: mono, BrightnessOffset: -20}, 0,
+			[]string{"set_bright[1 sudden 0]"}},
+		{"unknown brightness", Yeelight{}, []string{"bright"}, MirrorTarget{Light: mono}, 0, nil},
+		{"rgb", Yeelight{ColorMode: 1, RGB: 0xff8000}, []string{"rgb"}, MirrorTarget{Light: color}, 0,
+			[]string{fmt.Sprint("set_rgb[", 0xff8000, " sudden 0]")}},
+		{"rgb shifted", Yeelight{ColorMode: 1, RGB: 0xff0000}, []string{"color_mode"}, MirrorTarget{Light: color, Color: HueShift(120)}, 0,
+			[]string{fmt.Sprint("set_rgb[", 0x00ff00, " sudden 0]")}},
+		{"hsv", Yeelight{ColorMode: 3, Hue: 240, Saturation: 100}, []string{"hue"}, MirrorTarget{Light: color}, 0,
+			[]string{fmt.Sprint("set_rgb[", 0x0000ff, " sudden 0]")}},
+		{"hsv shifted backwards", Yeelight{ColorMode: 3, Hue: 60, Saturation: 100}, []string{"sat"}, MirrorTarget{Light: color, Color: HueShift(-180)}, 0,
+			[]string{fmt.Sprint("set_rgb[", 0x0000ff, " sudden 0]")}},
+		{"temperature", Yeelight{ColorMode: 2, ColorTemp: 7000}, []string{"ct"}, MirrorTarget{Light: color}, 0,
+			[]string{"set_ct_abx[6500 sudden 0]"}},
+		{"temperature shifted", Yeelight{ColorMode: 2, ColorTemp: 2700}, []string{"ct"}, MirrorTarget{Light: color, Color: HueShift(180)}, 0,
+			[]string{fmt.Sprint("set_rgb[", HueShift(180)(colorTempToRGB(2700)), " sudden 0]")}},
+		{"unchanged color", Yeelight{ColorMode: 1, RGB: 0xff0000}, []string{"ct"}, MirrorTarget{Light: color}, 0, nil},
+		{"rgb on temperature", Yeelight{ColorMode: 1, RGB: 0xff0000}, []string{"rgb"}, MirrorTarget{Light: temperature}, 0,
+			[]string{fmt.Sprint("set_ct_abx[", red, " sudden 0]")}},
+		{"temperature shifted on temperature", Yeelight{ColorMode: 2, ColorTemp: 2700}, []string{"ct"}, MirrorTarget{Light: temperature, Color: HueShift(180)}, 0,
+			[]string{"set_ct_abx[2700 sudden 0]"}},
+		{"rgb on mono", Yeelight{ColorMode: 1, RGB: 0xff0000, Bright: 40}, []string{"rgb", "bright"}, MirrorTarget{Light: mono}, 0,
+			[]string{"set_bright[40 sudden 0]"}},
+		{"temperature on mono", Yeelight{ColorMode: 2, ColorTemp: 2700}, []string{"color_mode"}, MirrorTarget{Light: mono}, 0, nil},
+	} {
+		changed := make(map[string]string)
+		for _, prop := range test.changed {
+			changed[prop] = ""
+		}
+
+		var got []string
+		for _, cmd := range mirrorCommands(test.state, changed, test.target, test.duration) {
+			got = append(got, fmt.Sprint(cmd.Method, cmd.Params))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package yeelight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+var errMusicUnsupported = errors.New("Light does not support music mode")
+
+// MusicConn is a music mode session: the light connects back to us and accepts
+// commands without quota and without answering them.
+type MusicConn struct {
+	light *Yeelight
+	conn  net.Conn
+
+	mu     sync.Mutex
+	lastID int
+}
+
+// SupportsMusic reports whether the light can be controlled in music mode.
+// Lights with unknown capabilities are assumed to support it.
+func (y *Yeelight) SupportsMusic() bool {
+	if len(y.Support) == 0 {
+		return true
+	}
+
+	for _, method := range y.Support {
+		if method == "set_music" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StartMusic starts a music mode session. host is the address of this machine as
+// seen by the light, it is found automatically when empty.
+func (y *Yeelight) StartMusic(ctx context.Context, host string) (*MusicConn, error) {
+	if !y.SupportsMusic() {
+		return nil, errMusicUnsupported
+	}
+
+	if host == "" {
+		var err error
+		if host, err = localAddr(y.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	if _, err := y.Call(ctx, "set_music", 1, host, port); err != nil {
+		return nil, err
+	}
+
+	// the light connects back right after acknowledging the command
+	deadline := time.Now().Add(y.clientOrDefault().readTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	ln.(*net.TCPListener).SetDeadline(deadline)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errConnectLight, err)
+	}
+
+	return &MusicConn{light: y, conn: conn}, nil
+}
+
+// localAddr returns the local address used to reach the light
+func localAddr(location string) (string, error) {
+	conn, err := net.Dial("udp", location)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	host, _, err := net.SplitHostPort(conn.LocalAddr().String())
+	return host, err
+}
+
+// Light returns the light of the session.
+func (m *MusicConn) Light() *Yeelight {
+	return m.light
+}
+
+// Send writes a command to the light. The light does not answer in music mode.
+func (m *MusicConn) Send(method string, params ...interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	m.lastID++
+	cmdJSON, err := json.Marshal(Command{ID: m.lastID, Method: method, Params: params})
+	if err != nil {
+		return errInvalidParam
+	}
+
+	m.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := fmt.Fprintf(m.conn, "%s\r\n", cmdJSON); err != nil {
+		return fmt.Errorf("%w: %w", errConnectLight, err)
+	}
+
+	return nil
+}
+
+// Close ends the music mode session.
+func (m *MusicConn) Close() error {
+	return m.conn.Close()
+}
+
+// Sender sends commands to a light, through a music mode session when
+// possible or with regular requests otherwise.
+type Sender struct {
+	light *Yeelight
+	host  string
+
+	mu     sync.Mutex
+	music  *MusicConn
+	failed time.Time // last failure to start a session
+}
+
+// musicRetryDelay is the time before trying again to start a music mode session
+const musicRetryDelay = 30 * time.Second
+
+// NewSender returns a sender for the light, host is passed to StartMusic.
+func NewSender(y *Yeelight, host string) *Sender {
+	return &Sender{light: y, host: host}
+}
+
+// Send sends a command to the light. A music mode session is started on the
+// first command, and started again if lost. Lights which cannot open one receive
+// regular requests, limited by their quota.
+func (s *Sender) Send(ctx context.Context, method string, params ...interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.music == nil && s.light.SupportsMusic() && time.Since(s.failed) > musicRetryDelay {
+		var err error
+		if s.music, err = s.light.StartMusic(ctx, s.host); err != nil {
+			s.failed = time.Now()
+		}
+	}
+
+	if s.music != nil {
+		err := s.music.Send(method, params...)
+		if err == nil {
+			return nil
+		}
+
+		s.music.Close()
+		s.music = nil
+	}
+
+	_, err := s.light.Call(ctx, method, params...)
+	return err
+}
+
+// Music reports whether the commands currently go through a music mode session.
+func (s *Sender) Music() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.music != nil
+}
+
+// Close ends the music mode session, if any.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.music == nil {
+		return nil
+	}
+
+	err := s.music.Close()
+	s.music = nil
+	return err
+}
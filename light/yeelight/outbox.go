@@ -0,0 +1,297 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrExpired is returned for a deferred command the light did not come back in time for.
+var ErrExpired = errors.New("Light did not come back before the command expired")
+
+// Advertisements listens to the SSDP advertisements sent by the lights when
+// they come online, and calls fn for each of them until the context is cancelled.
+func (c *Client) Advertisements(ctx context.Context, fn func(Yeelight)) error {
+	maddr, err := net.ResolveUDPAddr("udp4", c.multicast)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, maddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		light, err := parseAdvertisement(buf[:n])
+		if err != nil {
+			// discovery requests from other clients
+			continue
+		}
+
+		light.client = c
+		fn(light)
+	}
+}
+
+type deferredCommand struct {
+	ctx      context.Context
+	ex       *Exchange
+	location string // the address of the light, updated when it comes back elsewhere
+	next     Handler
+	sending  bool
+	expired  error // set when the command expires while being sent
+	done     chan error
+}
+
+// Outbox stores the commands sent to unreachable lights, and delivers them once
+// the lights are back, announced by their SSDP advertisements or found by probing.
+// Pending commands of the same kind are merged, the latest one only is delivered:
+// the requests of the older ones succeed, as the latest one applies their change.
+type Outbox struct {
+	client *Client
+	probe  time.Duration
+
+	mu      sync.Mutex
+	pending map[string][]*deferredCommand
+}
+
+// NewOutbox returns an outbox for the lights of the client, probing the
+// unreachable ones every probe interval. Call Run to deliver the commands.
+func NewOutbox(c *Client, probe time.Duration) *Outbox {
+	return &Outbox{client: c, probe: probe, pending: make(map[string][]*deferredCommand)}
+}
+
+// Middleware defers the commands failing because the light is unreachable, for
+// at most ttl. The request blocks until the command is delivered or expired.
+func (o *Outbox) Middleware(ttl time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, ex *Exchange) error {
+			err := next(ctx, ex)
+			if err == nil || !deferrable(ex.Command.Method, err) {
+				return err
+			}
+
+			return o.wait(ctx, ex, next, ttl, err)
+		}
+	}
+}
+
+// Pending returns the number of commands waiting for their light.
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for _, cmds := range o.pending {
+		n += len(cmds)
+	}
+
+	return n
+}
+
+// Run delivers the pending commands until the context is cancelled.
+func (o *Outbox) Run(ctx context.Context) error {
+	go o.client.Advertisements(ctx, func(light Yeelight) {
+		o.relocate(light)
+		o.deliver(light.ID)
+		o.deliver(light.Location)
+	})
+
+	ticker := time.NewTicker(o.probe)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			o.mu.Lock()
+			keys := make([]string, 0, len(o.pending))
+			for key := range o.pending {
+				keys = append(keys, key)
+			}
+			o.mu.Unlock()
+
+			for _, key := range keys {
+				o.deliver(key)
+			}
+		}
+	}
+}
+
+// deferrable reports whether a command can be delivered later: it did not
+// reach the light, or sending it again is harmless.
+func deferrable(method string, err error) bool {
+	return notSent(err) || (Retryable(err) && Idempotent(method))
+}
+
+// lightKey identifies a light, its address may change while it is offline
+func lightKey(y *Yeelight) string {
+	if y.ID != "" {
+		return y.ID
+	}
+
+	return y.Location
+}
+
+// wait stores the command and blocks until it is delivered or expired
+func (o *Outbox) wait(ctx context.Context, ex *Exchange, next Handler, ttl time.Duration, lastErr error) error {
+	cmd := &deferredCommand{ctx: ctx, ex: ex, location: ex.Light.Location, next: next, done: make(chan error, 1)}
+	key := lightKey(ex.Light)
+
+	o.mu.Lock()
+	cmds := o.pending[key]
+	merged := false
+	if kind, ok := mergeKeys[ex.Command.Method]; ok {
+		// replace the last pending command of the same kind, unless a
+		// command which cannot be merged was stored after it
+		for i := len(cmds) - 1; i >= 0 && !cmds[i].sending; i-- {
+			other, mergeable := mergeKeys[cmds[i].ex.Command.Method]
+			if !mergeable {
+				break
+			}
+			if other == kind {
+				cmds[i].done <- ErrSuperseded
+				cmds[i] = cmd
+				merged = true
+				break
+			}
+		}
+	}
+	if !merged {
+		o.pending[key] = append(cmds, cmd)
+	}
+	o.mu.Unlock()
+
+	timer := time.NewTimer(ttl)
+	defer timer.Stop()
+
+	select {
+	case err := <-cmd.done:
+		return superseded(ex, err)
+	case <-ctx.Done():
+		lastErr = ctx.Err()
+	case <-timer.C:
+		lastErr = fmt.Errorf("%w: %w", ErrExpired, lastErr)
+	}
+
+	if !o.remove(key, cmd, lastErr) {
+		// being delivered or superseded right now
+		return superseded(ex, <-cmd.done)
+	}
+
+	return lastErr
+}
+
+// superseded acknowledges a command replaced by a newer one of the same kind
+func superseded(ex *Exchange, err error) error {
+	if !errors.Is(err, ErrSuperseded) {
+		return err
+	}
+
+	ex.Response = Response{ID: ex.Command.ID, Result: []interface{}{"ok"}}
+	return nil
+}
+
+// remove drops a pending command, unless it is being sent
+func (o *Outbox) remove(key string, cmd *deferredCommand, reason error) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cmds := o.pending[key]
+	for i := range cmds {
+		if cmds[i] == cmd {
+			if cmd.sending {
+				cmd.expired = reason
+				return false
+			}
+
+			o.pending[key] = append(cmds[:i:i], cmds[i+1:]...)
+			if len(o.pending[key]) == 0 {
+				delete(o.pending, key)
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// relocate updates the address of the pending commands of a light advertised again
+func (o *Outbox) relocate(light Yeelight) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if light.ID == "" {
+		return
+	}
+
+	// the commands of the lights with an ID are stored under it
+	for _, cmd := range o.pending[light.ID] {
+		if !cmd.sending {
+			cmd.location = light.Location
+		}
+	}
+}
+
+// deliver sends the pending commands of a light in order, until one fails
+func (o *Outbox) deliver(key string) {
+	for {
+		o.mu.Lock()
+		cmds := o.pending[key]
+		if len(cmds) == 0 || cmds[0].sending {
+			o.mu.Unlock()
+			return
+		}
+		cmd := cmds[0]
+		cmd.sending = true
+		location := cmd.location
+		o.mu.Unlock()
+
+		// the light of the caller is not changed, it may be read by other goroutines
+		ex := *cmd.ex
+		if location != ex.Light.Location {
+			light := *ex.Light
+			light.Location = location
+			ex.Light = &light
+		}
+		err := cmd.next(cmd.ctx, &ex)
+		cmd.ex.Request, cmd.ex.Reply, cmd.ex.Response, cmd.ex.Duration = ex.Request, ex.Reply, ex.Response, ex.Duration
+
+		o.mu.Lock()
+		cmd.sending = false
+		if err != nil && deferrable(cmd.ex.Command.Method, err) {
+			if cmd.expired == nil {
+				// still unreachable
+				o.mu.Unlock()
+				return
+			}
+			err = cmd.expired
+		}
+
+		o.pending[key] = o.pending[key][1:]
+		if len(o.pending[key]) == 0 {
+			delete(o.pending, key)
+		}
+		o.mu.Unlock()
+
+		cmd.done <- err
+	}
+}
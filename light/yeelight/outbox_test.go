@@ -0,0 +1,132 @@
+package yeelight
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// offlineLights fails the commands sent to the addresses which are not online
+type offlineLights struct {
+	mu     sync.Mutex
+	online map[string]bool
+	sent   []string
+}
+
+func (l *offlineLights) middleware(next Handler) Handler {
+	return func(ctx context.Context, ex *Exchange) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if !l.online[ex.Light.Location] {
+			return fmt.Errorf("%w: %s", errResolveTCP, ex.Light.Location)
+		}
+
+		l.sent = append(l.sent, fmt.Sprint(ex.Light.Location, " ", ex.Command.Method, ex.Command.Params))
+		ex.Response = Response{ID: ex.Command.ID, Result: []interface{}{"ok"}}
+		return nil
+	}
+}
+
+func (l *offlineLights) setOnline(location string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.online[location] = true
+}
+
+func (l *offlineLights) commands() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string(nil), l.sent...)
+}
+
+func newOfflineOutbox() (*Outbox, *Client, *offlineLights) {
+	lights := &offlineLights{online: make(map[string]bool)}
+	client := NewClient()
+	outbox := NewOutbox(client, time.Hour)
+	client.Use(outbox.Middleware(time.Minute), lights.middleware)
+
+	return outbox, client, lights
+}
+
+// waitPending waits until the outbox stores n commands
+func waitPending(t *testing.T, o *Outbox, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for o.Pending() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d pending commands, want %d", o.Pending(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOutboxRelocate(t *testing.T) {
+	outbox, client, lights := newOfflineOutbox()
+	light := client.Bind(&Yeelight{ID: "0x01", Location: "10.0.0.1:55443"})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := light.Call(context.Background(), "set_power", "on")
+		done <- err
+	}()
+	waitPending(t, outbox, 1)
+
+	// the light came back with another address
+	lights.setOnline("10.0.0.2:55443")
+	outbox.relocate(Yeelight{ID: "0x01", Location: "10.0.0.2:55443"})
+	outbox.deliver("0x01")
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.2:55443 set_power[on]"}; !reflect.DeepEqual(lights.commands(), want) {
+		t.Fatalf("got %v, want %v", lights.commands(), want)
+	}
+	if light.Location != "10.0.0.1:55443" {
+		t.Fatalf("the light of the caller was changed to %s", light.Location)
+	}
+}
+
+func TestOutboxSuperseded(t *testing.T) {
+	outbox, client, lights := newOfflineOutbox()
+	light := client.Bind(&Yeelight{ID: "0x01", Location: "10.0.0.1:55443"})
+
+	first := make(chan Response, 1)
+	go func() {
+		resp, err := light.Call(context.Background(), "set_bright", 10)
+		if err != nil {
+			t.Error(err)
+		}
+		first <- resp
+	}()
+	waitPending(t, outbox, 1)
+
+	last := make(chan error, 1)
+	go func() {
+		_, err := light.Call(context.Background(), "set_bright", 20)
+		last <- err
+	}()
+
+	// the older command succeeds once replaced by the newer one
+	if resp := <-first; resp.OK() != nil {
+		t.Fatalf("superseded command: %v", resp.OK())
+	}
+	waitPending(t, outbox, 1)
+
+	lights.setOnline("10.0.0.1:55443")
+	outbox.deliver("0x01")
+
+	if err := <-last; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.1:55443 set_bright[20]"}; !reflect.DeepEqual(lights.commands(), want) {
+		t.Fatalf("got %v, want %v", lights.commands(), want)
+	}
+}
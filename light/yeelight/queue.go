@@ -0,0 +1,213 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Priority is the lane of a queued command. Commands of a higher priority lane
+// are always sent before the ones of lower lanes.
+type Priority int
+
+// Priorities of the commands
+const (
+	Interactive Priority = iota // commands from a user, sent first
+	Background                  // automations and effects
+	numPriorities
+)
+
+// ErrSuperseded is returned for a queued command replaced by a newer one of the same kind.
+var ErrSuperseded = errors.New("Command superseded by a newer one")
+
+// ErrQueueClosed is returned for the commands pending when Run stops, and the
+// ones submitted after.
+var ErrQueueClosed = errors.New("Command queue closed")
+
+// mergeKeys groups the methods which supersede each other: only the last
+// brightness or color set needs to reach the light.
+var mergeKeys = map[string]string{
+	"set_bright":    "bright",
+	"set_ct_abx":    "color",
+	"set_rgb":       "color",
+	"set_hsv":       "color",
+	"set_name":      "name",
+	"bg_set_bright": "bg_bright",
+	"bg_set_ct_abx": "bg_color",
+	"bg_set_rgb":    "bg_color",
+	"bg_set_hsv":    "bg_color",
+}
+
+// QueueResult is the outcome of a queued command.
+type QueueResult struct {
+	Response Response
+	Err      error
+}
+
+type queuedCommand struct {
+	ctx    context.Context
+	method string
+	params []interface{}
+	done   chan QueueResult
+}
+
+// Queue sends the commands of a light one at a time. Pending commands of the
+// same kind are merged, so sliders emitting many brightness changes only send
+// the latest one, while the commands which cannot be merged (power, flows...)
+// keep their order.
+type Queue struct {
+	light *Yeelight
+
+	mu     sync.Mutex
+	lanes  [numPriorities][]*queuedCommand
+	closed bool
+	wake   chan struct{}
+}
+
+// NewQueue returns a queue for the light. Call Run to start sending the commands.
+func NewQueue(y *Yeelight) *Queue {
+	return &Queue{light: y, wake: make(chan struct{}, 1)}
+}
+
+// Submit queues a command and returns a channel receiving its result.
+func (q *Queue) Submit(ctx context.Context, prio Priority, method string, params ...interface{}) <-chan QueueResult {
+	if prio < 0 || prio >= numPriorities {
+		prio = Background
+	}
+
+	cmd := &queuedCommand{ctx: ctx, method: method, params: params, done: make(chan QueueResult, 1)}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		cmd.done <- QueueResult{Err: ErrQueueClosed}
+		return cmd.done
+	}
+
+	lane := q.lanes[prio]
+	merged := false
+	if key, ok := mergeKeys[method]; ok {
+		// replace the last pending command of the same kind, unless a
+		// command which cannot be merged was queued after it
+		for i := len(lane) - 1; i >= 0; i-- {
+			other, mergeable := mergeKeys[lane[i].method]
+			if !mergeable {
+				break
+			}
+			if other == key {
+				lane[i].done <- QueueResult{Err: ErrSuperseded}
+				lane[i] = cmd
+				merged = true
+				break
+			}
+		}
+
+		// the lower lanes are sent after, their older commands of the same
+		// kind would overwrite this one
+		for lower := prio + 1; lower < numPriorities; lower++ {
+			kept := q.lanes[lower][:0]
+			for _, pending := range q.lanes[lower] {
+				if mergeKeys[pending.method] == key {
+					pending.done <- QueueResult{Err: ErrSuperseded}
+					continue
+				}
+				kept = append(kept, pending)
+			}
+			q.lanes[lower] = kept
+		}
+	}
+	if !merged {
+		q.lanes[prio] = append(lane, cmd)
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return cmd.done
+}
+
+// Send queues a command and waits for its result.
+func (q *Queue) Send(ctx context.Context, prio Priority, method string, params ...interface{}) (Response, error) {
+	select {
+	case res := <-q.Submit(ctx, prio, method, params...):
+		return res.Response, res.Err
+	case <-ctx.Done():
+		return Response{}, ctx.Err()
+	}
+}
+
+// Len returns the number of pending commands.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, lane := range q.lanes {
+		n += len(lane)
+	}
+
+	return n
+}
+
+// Run sends the queued commands until the context is cancelled. The pending
+// commands, and the ones submitted after, then fail with ErrQueueClosed.
+func (q *Queue) Run(ctx context.Context) error {
+	defer q.close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		cmd := q.next()
+		if cmd == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.wake:
+			}
+			continue
+		}
+
+		if err := cmd.ctx.Err(); err != nil {
+			cmd.done <- QueueResult{Err: err}
+			continue
+		}
+
+		resp, err := q.light.Call(cmd.ctx, cmd.method, cmd.params...)
+		cmd.done <- QueueResult{Response: resp, Err: err}
+	}
+}
+
+// close fails the pending commands and refuses the new ones
+func (q *Queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	for prio, lane := range q.lanes {
+		for _, cmd := range lane {
+			cmd.done <- QueueResult{Err: ErrQueueClosed}
+		}
+		q.lanes[prio] = nil
+	}
+}
+
+// next pops the first command of the highest priority lane
+func (q *Queue) next() *queuedCommand {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for prio := range q.lanes {
+		if len(q.lanes[prio]) > 0 {
+			cmd := q.lanes[prio][0]
+			q.lanes[prio] = q.lanes[prio][1:]
+			return cmd
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder answers the commands of its lights without a network, and records them
+func recorder() (*Client, func() []string) {
+	var mu sync.Mutex
+	var sent []string
+
+	c := NewClient(WithMiddleware(func(next Handler) Handler {
+		return func(ctx context.Context, ex *Exchange) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			sent = append(sent, fmt.Sprint(ex.Command.Method, ex.Command.Params))
+			ex.Response = Response{Result: []interface{}{"ok"}}
+			return nil
+		}
+	}))
+
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), sent...)
+	}
+}
+
+func TestQueueMergeAndPriority(t *testing.T) {
+	client, sent := recorder()
+	q := NewQueue(client.Bind(&Yeelight{Location: "127.0.0.1:55443"}))
+	ctx := context.Background()
+
+	// queued before Run, so that the order only depends on the queue
+	stale := q.Submit(ctx, Background, "set_bright", 10)
+	power := q.Submit(ctx, Background, "set_power", "on")
+	first := q.Submit(ctx, Interactive, "set_bright", 20)
+	last := q.Submit(ctx, Interactive, "set_bright", 30)
+	color := q.Submit(ctx, Interactive, "set_rgb", 255)
+
+	for name, ch := range map[string]<-chan QueueResult{"background": stale, "first": first} {
+		if res := <-ch; !errors.Is(res.Err, ErrSuperseded) {
+			t.Errorf("%s set_bright: got %v, want ErrSuperseded", name, res.Err)
+		}
+	}
+	if q.Len() != 3 {
+		t.Fatalf("got %d pending commands, want 3", q.Len())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Run(ctx)
+
+	for _, ch := range []<-chan QueueResult{last, color, power} {
+		if res := <-ch; res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+
+	want := []string{"set_bright[30]", "set_rgb[255]", "set_power[on]"}
+	if got := sent(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestQueueMergeKeepsOrder(t *testing.T) {
+	client, sent := recorder()
+	q := NewQueue(client.Bind(&Yeelight{Location: "127.0.0.1:55443"}))
+	ctx := context.Background()
+
+	// a command which cannot be merged keeps the commands before it
+	a := q.Submit(ctx, Interactive, "set_bright", 10)
+	b := q.Submit(ctx, Interactive, "set_power", "off")
+	c := q.Submit(ctx, Interactive, "set_bright", 20)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go q.Run(ctx)
+
+	for _, ch := range []<-chan QueueResult{a, b, c} {
+		if res := <-ch; res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+
+	want := []string{"set_bright[10]", "set_power[off]", "set_bright[20]"}
+	if got := sent(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestQueueClosed(t *testing.T) {
+	client, sent := recorder()
+	q := NewQueue(client.Bind(&Yeelight{Location: "127.0.0.1:55443"}))
+
+	pending := q.Submit(context.Background(), Interactive, "set_power", "on")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run returned %v, want context.Canceled", err)
+	}
+
+	if res := <-pending; !errors.Is(res.Err, ErrQueueClosed) {
+		t.Fatalf("pending command: got %v, want ErrQueueClosed", res.Err)
+	}
+
+	send, cancelSend := context.WithTimeout(context.Background(), time.Second)
+	defer cancelSend()
+	if _, err := q.Send(send, Interactive, "set_power", "off"); !errors.Is(err, ErrQueueClosed) {
+		t.Fatalf("command after Run: got %v, want ErrQueueClosed", err)
+	}
+
+	if got := sent(); len(got) != 0 {
+		t.Fatalf("got %v sent by a closed queue", got)
+	}
+}
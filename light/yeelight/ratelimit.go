@@ -0,0 +1,74 @@
+package yeelight
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the requests sent to each light.
+type tokenBucket struct {
+	limit  int
+	period time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing limit requests per period to each
+// light, with bursts up to limit. The lights allow 60 requests per minute.
+func NewRateLimiter(limit int, period time.Duration) RateLimiter {
+	return &tokenBucket{limit: limit, period: period, buckets: make(map[string]*bucket)}
+}
+
+// Wait blocks until a request can be sent to the light at location
+func (t *tokenBucket) Wait(ctx context.Context, location string) error {
+	if t.limit <= 0 || t.period <= 0 {
+		return nil
+	}
+
+	for {
+		wait := t.reserve(location)
+		if wait == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reserve takes a token if available, or returns how long to wait for one
+func (t *tokenBucket) reserve(location string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	b, ok := t.buckets[location]
+	if !ok {
+		b = &bucket{tokens: float64(t.limit), last: now}
+		t.buckets[location] = b
+	}
+
+	rate := float64(t.limit) / float64(t.period)
+	b.tokens += float64(now.Sub(b.last)) * rate
+	if b.tokens > float64(t.limit) {
+		b.tokens = float64(t.limit)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / rate)
+}
@@ -0,0 +1,144 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy describes how failed requests are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, 1 or less disables retries
+	BaseDelay   time.Duration // delay before the first retry, doubled on each attempt
+	MaxDelay    time.Duration // upper bound of the delay between two attempts
+	Jitter      float64       // fraction of the delay randomly removed, between 0 and 1
+}
+
+// DefaultRetryPolicy retries twice, which is enough to get over the dropped
+// connections usual on 2.4 GHz bulbs.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Jitter:      0.5,
+}
+
+// nonIdempotent methods change the state relatively to the current one,
+// sending them twice does not give the same result as sending them once.
+var nonIdempotent = map[string]bool{
+	"toggle":           true,
+	"bg_toggle":        true,
+	"dev_toggle":       true,
+	"set_adjust":       true,
+	"bg_set_adjust":    true,
+	"adjust_bright":    true,
+	"adjust_ct":        true,
+	"adjust_color":     true,
+	"bg_adjust_bright": true,
+	"bg_adjust_ct":     true,
+	"bg_adjust_color":  true,
+}
+
+// Idempotent reports whether a method can safely be sent several times.
+func Idempotent(method string) bool {
+	return !nonIdempotent[method]
+}
+
+// Retryable reports whether a request failing with err may succeed if sent again.
+// Connection failures and quota rejections are retryable, device errors and
+// invalid parameters are not.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, errInvalidParam) ||
+		errors.Is(err, ErrExpired) || errors.Is(err, ErrSuperseded) || errors.Is(err, ErrQueueClosed) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var devErr Error
+	if errors.As(err, &devErr) {
+		return devErr.QuotaExceeded()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, errResolveTCP) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// notSent reports whether a request failed before reaching the light, in
+// which case even a non idempotent method can be sent again.
+func notSent(err error) bool {
+	var devErr Error
+	if errors.As(err, &devErr) {
+		return devErr.QuotaExceeded()
+	}
+
+	return errors.Is(err, errResolveTCP)
+}
+
+// delay returns the backoff before the given retry (starting at 1).
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+
+	return d
+}
+
+// Retry sends again the exchanges failing with a retryable error, following the policy.
+// Non idempotent methods are only retried when the light never received them.
+func Retry(p RetryPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, ex *Exchange) error {
+			var err error
+			for attempt := 1; ; attempt++ {
+				ex.Request, ex.Reply, ex.Response = nil, nil, Response{}
+
+				err = next(ctx, ex)
+				if err == nil || attempt >= p.MaxAttempts || !Retryable(err) {
+					return err
+				}
+
+				if !Idempotent(ex.Command.Method) && !notSent(err) {
+					return err
+				}
+
+				select {
+				case <-ctx.Done():
+					return err
+				case <-time.After(p.delay(attempt)):
+				}
+			}
+		}
+	}
+}
+
+// QuotaExceeded reports whether the light rejected the command because the
+// client sent too many of them (the limit is 60 per minute).
+func (e Error) QuotaExceeded() bool {
+	return strings.Contains(strings.ToLower(e.Message), "quota")
+}
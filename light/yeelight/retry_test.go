@@ -0,0 +1,155 @@
+package yeelight
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyLight is a light whose connections follow a script: "refuse" fails to
+// connect, "drop" closes the connection once the command is received, and
+// "answer" answers it
+type flakyLight struct {
+	mu       sync.Mutex
+	script   []string
+	received []string
+}
+
+func (l *flakyLight) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	step := "answer"
+	if len(l.script) > 0 {
+		step, l.script = l.script[0], l.script[1:]
+	}
+	if step == "refuse" {
+		return nil, syscall.ECONNREFUSED
+	}
+
+	client, light := net.Pipe()
+	go func() {
+		defer light.Close()
+
+		data, err := bufio.NewReader(light).ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		l.mu.Lock()
+		l.received = append(l.received, string(data))
+		l.mu.Unlock()
+
+		if step == "answer" {
+			var cmd Command
+			fmt.Sscanf(string(data), `{"id":%d`, &cmd.ID)
+			fmt.Fprintf(light, "{\"id\":%d,\"result\":[\"ok\"]}\r\n", cmd.ID)
+		}
+	}()
+
+	return client, nil
+}
+
+func (l *flakyLight) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.received)
+}
+
+func flakyClient(script ...string) (*Yeelight, *flakyLight) {
+	light := &flakyLight{script: script}
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	client := NewClient(WithDialer(light), WithRetryPolicy(policy), WithReadTimeout(time.Second))
+
+	return client.Bind(&Yeelight{Location: "127.0.0.1:55443"}), light
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, test := range []struct {
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{RetryPolicy{BaseDelay: 100 * time.Millisecond}, []time.Duration{100, 200, 400, 800}},
+		{RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 250 * time.Millisecond}, []time.Duration{100, 200, 250, 250}},
+	} {
+		for i, want := range test.want {
+			if got := test.policy.delay(i + 1); got != want*time.Millisecond {
+				t.Errorf("%+v, retry %d: got %v, want %v", test.policy, i+1, got, want*time.Millisecond)
+			}
+		}
+	}
+
+	// the jitter only shortens the delay
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if d := p.delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("got %v, want between 50ms and 100ms", d)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, test := range []struct {
+		err       error
+		retryable bool
+		notSent   bool
+	}{
+		{fmt.Errorf("%w: %w", errResolveTCP, syscall.ECONNREFUSED), true, true},
+		{fmt.Errorf("%w: %w", errConnectLight, io.EOF), true, false},
+		{fmt.Errorf("%w: %w", errConnectLight, syscall.ECONNRESET), true, false},
+		{Error{Code: -1, Message: "client quota exceeded"}, true, true},
+		{Error{Code: -1, Message: "unsupported method"}, false, false},
+		{errInvalidParam, false, false},
+		{context.Canceled, false, false},
+		{ErrSuperseded, false, false},
+		{nil, false, false},
+	} {
+		if got := Retryable(test.err); got != test.retryable {
+			t.Errorf("Retryable(%v): got %t, want %t", test.err, got, test.retryable)
+		}
+		if test.err == nil {
+			continue
+		}
+		if got := notSent(test.err); got != test.notSent {
+			t.Errorf("notSent(%v): got %t, want %t", test.err, got, test.notSent)
+		}
+	}
+}
+
+func TestRetryResend(t *testing.T) {
+	light, fake := flakyClient("refuse", "drop", "answer")
+
+	if _, err := light.Call(context.Background(), "set_power", "on"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.count() != 2 {
+		t.Fatalf("set_power received %d times, want 2", fake.count())
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	// never received, it is sent again
+	light, fake := flakyClient("refuse", "answer")
+	if _, err := light.Call(context.Background(), "toggle"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.count() != 1 {
+		t.Fatalf("toggle received %d times, want 1", fake.count())
+	}
+
+	// received but not answered, it may have been applied
+	light, fake = flakyClient("drop", "answer")
+	if _, err := light.Call(context.Background(), "adjust_bright", 10, 500); !errors.Is(err, errConnectLight) {
+		t.Fatalf("got %v, want the connection error", err)
+	}
+	if fake.count() != 1 {
+		t.Fatalf("adjust_bright received %d times, want 1", fake.count())
+	}
+}
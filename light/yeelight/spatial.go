@@ -0,0 +1,189 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Point is the position of a light in a room.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// PlacedLight is a light with its position.
+type PlacedLight struct {
+	Light    *Yeelight
+	Position Point
+}
+
+// SpatialKind is the shape of a spatial effect
+type SpatialKind string
+
+// Spatial effects
+const (
+	Wave     SpatialKind = "wave"     // sine wave of colors moving across the room
+	Sweep    SpatialKind = "sweep"    // band of light crossing the room, a chaser along corridors
+	Pulse    SpatialKind = "pulse"    // rings of light expanding from a center
+	Gradient SpatialKind = "gradient" // gradient of colors scrolling across the room
+)
+
+var errInvalidSpatial = errors.New("Invalid spatial effect")
+
+// SpatialEffect computes the color of each light from its position and time.
+// Positions are normalized to the bounding box of the lights, so that the room
+// spans from 0 to 1 on both axes.
+type SpatialEffect struct {
+	Kind       SpatialKind
+	Color      int     // color of the wave crests, sweeps and pulses
+	Background int     // color elsewhere
+	Bright     int     // brightness of the lights, 1 to 100
+	Angle      float64 // direction of waves, sweeps and gradients in degrees, 0 goes along the X axis
+	Speed      float64 // room crossings per second
+	Width      float64 // width of sweeps and pulses, or wave length, as a fraction of the room
+	Center     Point   // origin of pulses
+}
+
+// Validate checks the effect can be played.
+func (e SpatialEffect) Validate() error {
+	switch e.Kind {
+	case Wave, Sweep, Pulse, Gradient:
+	default:
+		return fmt.Errorf("%w: unknown kind %q", errInvalidSpatial, e.Kind)
+	}
+
+	if e.Bright < 1 || e.Bright > 100 {
+		return fmt.Errorf("%w: brightness %d out of range", errInvalidSpatial, e.Bright)
+	}
+
+	if e.Width <= 0 {
+		return fmt.Errorf("%w: width must be positive", errInvalidSpatial)
+	}
+
+	return nil
+}
+
+// At returns the frame of a light at the normalized position p, at the instant t.
+func (e SpatialEffect) At(p Point, t time.Duration) Frame {
+	elapsed := t.Seconds() * e.Speed
+	var intensity float64
+
+	switch e.Kind {
+	case Wave:
+		phase := (e.along(p) - elapsed) / e.Width
+		intensity = (1 + math.Sin(2*math.Pi*phase)) / 2
+	case Sweep:
+		// the band enters and leaves the room completely
+		center := frac(elapsed)*(1+2*e.Width) - e.Width
+		intensity = math.Max(0, 1-math.Abs(e.along(p)-center)/e.Width)
+	case Pulse:
+		radius := frac(elapsed) * math.Sqrt2
+		distance := math.Hypot(p.X-e.Center.X, p.Y-e.Center.Y)
+		intensity = math.Max(0, 1-math.Abs(distance-radius)/e.Width)
+	case Gradient:
+		intensity = 1 - math.Abs(2*frac(e.along(p)-elapsed)-1)
+	}
+
+	return interpolate(
+		Frame{Bright: e.Bright, RGB: e.Background},
+		Frame{Bright: e.Bright, RGB: e.Color},
+		intensity,
+	)
+}
+
+// along projects a normalized position on the direction of the effect, from 0 to 1
+func (e SpatialEffect) along(p Point) float64 {
+	rad := e.Angle * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+
+	// bounds of the projection of the unit square
+	min := math.Min(0, cos) + math.Min(0, sin)
+	max := math.Max(0, cos) + math.Max(0, sin)
+
+	return (p.X*cos + p.Y*sin - min) / (max - min)
+}
+
+// frac returns the fractional part of v, between 0 and 1
+func frac(v float64) float64 {
+	return v - math.Floor(v)
+}
+
+// normalize maps the positions to the bounding box of the lights. Lights
+// aligned on an axis are centered on it.
+func normalize(lights []PlacedLight) []Point {
+	if len(lights) == 0 {
+		return nil
+	}
+
+	minX, maxX := lights[0].Position.X, lights[0].Position.X
+	minY, maxY := lights[0].Position.Y, lights[0].Position.Y
+	for _, l := range lights {
+		minX, maxX = math.Min(minX, l.Position.X), math.Max(maxX, l.Position.X)
+		minY, maxY = math.Min(minY, l.Position.Y), math.Max(maxY, l.Position.Y)
+	}
+
+	scale := func(v, min, max float64) float64 {
+		if max == min {
+			return 0.5
+		}
+		return (v - min) / (max - min)
+	}
+
+	points := make([]Point, len(lights))
+	for i, l := range lights {
+		points[i] = Point{X: scale(l.Position.X, minX, maxX), Y: scale(l.Position.Y, minY, maxY)}
+	}
+
+	return points
+}
+
+// PlaySpatial plays the effect on the placed lights at the given frame rate, for
+// the given duration or until the context is cancelled when it is zero.
+// host is the local address given to the lights for music mode, found automatically when empty.
+func PlaySpatial(ctx context.Context, e SpatialEffect, lights []PlacedLight, fps float64, duration time.Duration, host string) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	if fps <= 0 || fps > 60 {
+		return fmt.Errorf("%w: frame rate must be between 0 and 60", errInvalidSpatial)
+	}
+
+	points := normalize(lights)
+	renderers := make([]*FrameRenderer, len(lights))
+	for i, l := range lights {
+		sender := NewSender(l.Light, host)
+		defer sender.Close()
+		renderers[i] = NewFrameRenderer(sender)
+	}
+
+	interval := time.Duration(float64(time.Second) / fps)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		elapsed := time.Since(start)
+
+		var errs []error
+		for i, r := range renderers {
+			errs = append(errs, r.Render(ctx, e.At(points[i], elapsed), interval))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+
+		if duration > 0 && elapsed >= duration {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
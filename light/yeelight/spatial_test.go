@@ -0,0 +1,81 @@
+package yeelight
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSpatialAt(t *testing.T) {
+	wave := SpatialEffect{Kind: Wave, Color: 0xffffff, Background: 0x000000, Bright: 50, Speed: 1, Width: 1}
+	vertical := wave
+	vertical.Angle = 90
+	pulse := SpatialEffect{Kind: Pulse, Color: 0xffffff, Bright: 50, Speed: 1, Width: 0.25}
+	sweep := SpatialEffect{Kind: Sweep, Color: 0xffffff, Bright: 50, Speed: 1, Width: 0.5}
+
+	for _, test := range []struct {
+		name   string
+		effect SpatialEffect
+		p      Point
+		t      time.Duration
+		want   int
+	}{
+		{"wave crest", wave, Point{0.25, 0}, 0, 0xffffff},
+		{"wave trough", wave, Point{0.75, 0.5}, 0, 0x000000},
+		{"wave middle", wave, Point{0, 1}, 0, 0x808080},
+		{"wave moved", wave, Point{0.25, 0}, 250 * time.Millisecond, 0x808080},
+		{"wave crest moved", wave, Point{0.5, 0}, 250 * time.Millisecond, 0xffffff},
+		{"wave crossed", wave, Point{0.25, 0}, time.Second, 0xffffff},
+		{"vertical wave crest", vertical, Point{1, 0.25}, 0, 0xffffff},
+		{"vertical wave trough", vertical, Point{0.25, 0.75}, 0, 0x000000},
+		{"pulse center", pulse, Point{0, 0}, 0, 0xffffff},
+		{"pulse outside", pulse, Point{0.5, 0}, 0, 0x000000},
+		{"pulse ring", pulse, Point{0.5, 0.5}, 500 * time.Millisecond, 0xffffff},
+		{"pulse inside", pulse, Point{0, 0}, 500 * time.Millisecond, 0x000000},
+		{"pulse edge", pulse, Point{0.125, 0}, 0, 0x808080},
+		{"sweep outside", sweep, Point{0, 0}, 0, 0x000000},
+		{"sweep center", sweep, Point{0.5, 1}, 500 * time.Millisecond, 0xffffff},
+		{"sweep edge", sweep, Point{0.25, 1}, 500 * time.Millisecond, 0x808080},
+	} {
+		got := test.effect.At(test.p, test.t)
+		if got.RGB != test.want || got.Bright != 50 {
+			t.Errorf("%s: got %06x at %d, want %06x at 50", test.name, got.RGB, got.Bright, test.want)
+		}
+	}
+}
+
+func TestSpatialAlong(t *testing.T) {
+	for _, test := range []struct {
+		angle float64
+		p     Point
+		want  float64
+	}{
+		{0, Point{0.3, 0.9}, 0.3},
+		{90, Point{0.3, 0.9}, 0.9},
+		{180, Point{0.3, 0.9}, 0.7},
+		{45, Point{0, 0}, 0},
+		{45, Point{1, 0}, 0.5},
+		{45, Point{1, 1}, 1},
+	} {
+		if got := (SpatialEffect{Angle: test.angle}).along(test.p); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%v° at %v: got %v, want %v", test.angle, test.p, got, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got := normalize([]PlacedLight{
+		{Position: Point{2, 1}},
+		{Position: Point{6, 1}},
+		{Position: Point{4, 1}},
+	})
+
+	// aligned on the X axis, the lights are centered on Y
+	want := []Point{{0, 0.5}, {1, 0.5}, {0.5, 0.5}}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package yeelight
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// statusProps are read by Status in addition to the state of Yeelight
+var statusProps = []string{"power", "bright", "ct", "rgb", "hue", "sat", "color_mode", "name", "flowing", "delayoff"}
+
+// Status is a snapshot of a light, with the properties which are not kept in Yeelight.
+type Status struct {
+	Light      Yeelight
+	Flowing    bool          // a color flow is running
+	SleepTimer time.Duration // left before the light turns off, 0 without timer
+	Latency    time.Duration // round trip of the request
+}
+
+// Status reads the state of the light, as GetProp does, with its color flow
+// and its sleep timer.
+func (y *Yeelight) Status(ctx context.Context) (Status, error) {
+	cmd := Command{
+		ID:     1,
+		Method: "get_prop",
+		Params: statusProps,
+	}
+
+	start := time.Now()
+	resp, err := y.clientOrDefault().do(ctx, y, cmd)
+	if err != nil {
+		return Status{}, err
+	}
+	latency := time.Since(start)
+
+	values, err := resp.Strings()
+	if err != nil {
+		return Status{}, err
+	}
+
+	if len(values) != len(statusProps) {
+		return Status{}, fmt.Errorf("%w: expected %d properties, got %d", errInvalidResponse, len(statusProps), len(values))
+	}
+
+	status := Status{Light: *y, Latency: latency}
+	for i, prop := range statusProps {
+		switch prop {
+		case "flowing":
+			status.Flowing = values[i] == "1"
+		case "delayoff":
+			// the lights without timer return an empty value
+			minutes, _ := strconv.Atoi(values[i])
+			status.SleepTimer = time.Duration(minutes) * time.Minute
+		default:
+			if err := status.Light.setProp(prop, values[i]); err != nil {
+				return Status{}, err
+			}
+		}
+	}
+	*y = status.Light
+
+	return status, nil
+}
+
+// DisplayRGB returns the color shown by the light in RGB, whatever its color mode.
+func (y *Yeelight) DisplayRGB() int {
+	switch y.ColorMode {
+	case 2:
+		return colorTempToRGB(y.ColorTemp)
+	case 3:
+		return HSVToRGB(float64(y.Hue), float64(y.Saturation))
+	default:
+		return y.RGB
+	}
+}
@@ -0,0 +1,185 @@
+package yeelight
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SyncGroup sends commands to several lights so that they land at the same
+// instant, compensating the latency of each light.
+type SyncGroup struct {
+	members []*syncMember
+}
+
+type syncMember struct {
+	conn    *Conn
+	latency time.Duration // round trip time
+}
+
+// SyncReport tells when the command of a synchronized dispatch reached each
+// light, estimated from the round trip of the command.
+type SyncReport struct {
+	Landed map[string]time.Time // by light location
+	Errors map[string]error     // by light location
+	Spread time.Duration        // between the first and the last light reached
+}
+
+// PrepareSync opens a connection to each light and measures its round trip
+// time with the given number of samples. The lights which cannot be reached are
+// reported in the error, the group contains the others.
+func PrepareSync(ctx context.Context, lights []*Yeelight, samples int) (*SyncGroup, error) {
+	if samples < 1 {
+		samples = 1
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+		g    = &SyncGroup{}
+	)
+
+	for _, light := range lights {
+		wg.Add(1)
+		go func(light *Yeelight) {
+			defer wg.Done()
+
+			m, err := prepareMember(ctx, light, samples)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			g.members = append(g.members, m)
+		}(light)
+	}
+	wg.Wait()
+
+	return g, errors.Join(errs...)
+}
+
+// prepareMember opens the connection to a light and measures its median round trip time
+func prepareMember(ctx context.Context, light *Yeelight, samples int) (*syncMember, error) {
+	conn, err := light.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rtts := make([]time.Duration, 0, samples)
+	for i := 0; i < samples; i++ {
+		start := time.Now()
+		if _, err := conn.Call(ctx, "get_prop", "power"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		rtts = append(rtts, time.Since(start))
+	}
+
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	return &syncMember{conn: conn, latency: rtts[len(rtts)/2]}, nil
+}
+
+// Latencies returns the measured round trip time of each light, by location.
+func (g *SyncGroup) Latencies() map[string]time.Duration {
+	latencies := make(map[string]time.Duration, len(g.members))
+	for _, m := range g.members {
+		latencies[m.conn.light.Location] = m.latency
+	}
+
+	return latencies
+}
+
+// Close closes the connections of the group.
+func (g *SyncGroup) Close() error {
+	var errs []error
+	for _, m := range g.members {
+		errs = append(errs, m.conn.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// Dispatch sends the method to every light of the group so that it reaches them at
+// the given instant. A zero instant means as soon as the slowest light can be reached.
+func (g *SyncGroup) Dispatch(ctx context.Context, at time.Time, method string, params ...interface{}) SyncReport {
+	if at.IsZero() {
+		var slowest time.Duration
+		for _, m := range g.members {
+			if m.latency > slowest {
+				slowest = m.latency
+			}
+		}
+		// leave some time to the goroutines to start
+		at = time.Now().Add(slowest/2 + 10*time.Millisecond)
+	}
+
+	report := SyncReport{Landed: make(map[string]time.Time), Errors: make(map[string]error)}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, m := range g.members {
+		wg.Add(1)
+		go func(m *syncMember) {
+			defer wg.Done()
+
+			landed, err := m.dispatch(ctx, at, method, params)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Errors[m.conn.light.Location] = err
+				return
+			}
+			report.Landed[m.conn.light.Location] = landed
+		}(m)
+	}
+	wg.Wait()
+
+	var first, last time.Time
+	for _, landed := range report.Landed {
+		if first.IsZero() || landed.Before(first) {
+			first = landed
+		}
+		if landed.After(last) {
+			last = landed
+		}
+	}
+	report.Spread = last.Sub(first)
+
+	return report
+}
+
+// dispatch sends the command half a round trip before the target instant,
+// and returns when it reached the light
+func (m *syncMember) dispatch(ctx context.Context, at time.Time, method string, params []interface{}) (time.Time, error) {
+	m.conn.mu.Lock()
+	defer m.conn.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at.Add(-m.latency / 2)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return time.Time{}, ctx.Err()
+	case <-timer.C:
+	}
+
+	sent := time.Now()
+	id, err := m.conn.write(method, params)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if _, err := m.conn.read(ctx, id); err != nil {
+		return time.Time{}, err
+	}
+
+	return sent.Add(time.Since(sent) / 2), nil
+}
@@ -1,15 +1,10 @@
 package yeelight
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net"
-	"net/textproto"
-	"net/url"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -17,8 +12,6 @@ import (
 const Port = "55443"
 
 var (
-	timeout  = time.Duration(2 * time.Second)
-	discover = "M-SEARCH * HTTP/1.1\r\nHOST:239.255.255.250:1982\r\nMAN:\"ssdp:discover\"\r\nST:wifi_bulb\r\n"
 	// error messages
 	errResolveTCP   = errors.New("Cannot resolve TCP address")
 	errConnectLight = errors.New("Cannot connect to light")
@@ -40,6 +33,9 @@ type Yeelight struct {
 	Hue        int      `json:"hue,omitempty"`
 	Saturation int      `json:"sat,omitempty"`
 	Name       string   `json:"name"`
+
+	client *Client
+	live   *LiveLight
 }
 
 //Command to send to the light
@@ -62,14 +58,24 @@ type Error struct {
 	Message string `json:"message"`
 }
 
+// Error makes the device error usable as a Go error
+func (e Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
 //Discover uses SSDP to find and return the IP address of the lights
-//credit: https://github.com/edgard/yeelight/blob/master/yeelight.go
 func Discover(timeout time.Duration) ([]Yeelight, error) {
+	return DefaultClient.Discover(timeout)
+}
+
+// Discover uses SSDP to find and return the lights, bound to the client
+// credit: https://github.com/edgard/yeelight/blob/master/yeelight.go
+func (c *Client) Discover(timeout time.Duration) ([]Yeelight, error) {
 	laddr, err := net.ResolveUDPAddr("udp4", ":0")
 	if err != nil {
 		return nil, err
 	}
-	maddr, err := net.ResolveUDPAddr("udp4", "239.255.255.250:1982")
+	maddr, err := net.ResolveUDPAddr("udp4", c.multicast)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +85,7 @@ func Discover(timeout time.Duration) ([]Yeelight, error) {
 	}
 	defer conn.Close()
 
+	discover := "M-SEARCH * HTTP/1.1\r\nHOST:" + c.multicast + "\r\nMAN:\"ssdp:discover\"\r\nST:wifi_bulb\r\n"
 	go func() {
 		conn.WriteToUDP([]byte(discover), maddr)
 	}()
@@ -99,26 +106,13 @@ func Discover(timeout time.Duration) ([]Yeelight, error) {
 
 	var lights []Yeelight
 	for _, answer := range answers {
-		tp := textproto.NewReader(bufio.NewReader(strings.NewReader(answer)))
-		tp.ReadLine()
-		header, _ := tp.ReadMIMEHeader()
-
-		var light Yeelight
-		location, _ := url.Parse(header.Get("location"))
-		light.Location = location.Host
-		light.ID = header.Get("id")
-		light.Model = header.Get("model")
-		light.FWVersion, _ = strconv.Atoi(header.Get("fw_ver"))
-		light.Support = strings.Split(header.Get("support"), " ")
-		light.Power = header.Get("power")
-		light.Bright, _ = strconv.Atoi(header.Get("bright"))
-		light.ColorMode, _ = strconv.Atoi(header.Get("color_mode"))
-		light.ColorTemp, _ = strconv.Atoi(header.Get("ct"))
-		light.RGB, _ = strconv.Atoi(header.Get("rgb"))
-		light.Hue, _ = strconv.Atoi(header.Get("hue"))
-		light.Saturation, _ = strconv.Atoi(header.Get("sat"))
-		light.Name = header.Get("name")
+		light, err := parseAdvertisement([]byte(answer))
+		if err != nil {
+			// not a light or a corrupted answer
+			continue
+		}
 
+		light.client = c
 		lights = append(lights, light)
 	}
 
@@ -127,57 +121,81 @@ func Discover(timeout time.Duration) ([]Yeelight, error) {
 
 // Handles the request
 func (y *Yeelight) request(cmd Command) (Response, error) {
-	conn, err := net.DialTimeout("tcp", y.Location, timeout)
-	if err != nil {
-		return Response{}, errResolveTCP
-	}
-	defer conn.Close()
+	return y.clientOrDefault().do(context.Background(), y, cmd)
+}
 
-	cmdJSON, err := json.Marshal(cmd)
-	if err != nil {
-		return Response{}, errInvalidParam
+// clientOrDefault returns the client the light is bound to
+func (y *Yeelight) clientOrDefault() *Client {
+	if y.client == nil {
+		return DefaultClient
 	}
 
-	if _, err := fmt.Fprintf(conn, "%s\r\n", cmdJSON); err != nil {
-		return Response{}, errConnectLight
+	return y.client
+}
+
+// Call sends any method to the light, including the ones not wrapped by this
+// package, and returns the full response. Errors reported by the light are
+// returned as an Error.
+func (y *Yeelight) Call(ctx context.Context, method string, params ...interface{}) (Response, error) {
+	if params == nil {
+		params = []interface{}{}
 	}
 
-	data, err := bufio.NewReader(conn).ReadString('\n')
-	if err != nil {
-		return Response{}, errConnectLight
+	c := y.clientOrDefault()
+	cmd := Command{
+		ID:     c.nextID(),
+		Method: method,
+		Params: params,
 	}
 
-	// parse response
-	resp := Response{}
-	err = json.Unmarshal([]byte(data), &resp)
+	return c.do(ctx, y, cmd)
+}
+
+// requestOK sends a command expecting the light to acknowledge it with "ok"
+func (y *Yeelight) requestOK(cmd Command) (Response, error) {
+	resp, err := y.request(cmd)
 	if err != nil {
-		return Response{}, err
+		return resp, err
 	}
 
-	return resp, nil
+	return resp, resp.OK()
 }
 
 //GetProp method is used to retrieve current property a light
 func (y *Yeelight) GetProp() error {
+	return y.getProp(context.Background())
+}
+
+func (y *Yeelight) getProp(ctx context.Context) error {
+	props := []string{"power", "bright", "ct", "rgb", "hue", "sat", "color_mode", "name"}
 	cmd := Command{
 		ID:     1,
 		Method: "get_prop",
-		Params: []interface{}{"power", "bright", "ct", "rgb", "hue", "sat", "color_mode", "name"},
+		Params: props,
 	}
 
-	resp, err := y.request(cmd)
+	resp, err := y.clientOrDefault().do(ctx, y, cmd)
 	if err != nil {
 		return err
 	}
 
-	y.Power = resp.Result.([]interface{})[0].(string)
-	y.Bright, _ = strconv.Atoi(resp.Result.([]interface{})[1].(string))
-	y.ColorTemp, _ = strconv.Atoi(resp.Result.([]interface{})[2].(string))
-	y.RGB, _ = strconv.Atoi(resp.Result.([]interface{})[3].(string))
-	y.Hue, _ = strconv.Atoi(resp.Result.([]interface{})[4].(string))
-	y.Saturation, _ = strconv.Atoi(resp.Result.([]interface{})[5].(string))
-	y.ColorMode, _ = strconv.Atoi(resp.Result.([]interface{})[6].(string))
-	y.Name, _ = resp.Result.([]interface{})[7].(string)
+	values, err := resp.Strings()
+	if err != nil {
+		return err
+	}
+
+	if len(values) != len(props) {
+		return fmt.Errorf("%w: expected %d properties, got %d", errInvalidResponse, len(props), len(values))
+	}
+
+	// apply the values only once all of them are valid
+	light := *y
+	for i, prop := range props {
+		if err := light.setProp(prop, values[i]); err != nil {
+			return err
+		}
+	}
+	*y = light
 
 	return nil
 }
@@ -206,7 +224,7 @@ func (y *Yeelight) SetCtAbx(value, duration int) (Response, error) {
 		Params: []interface{}{value, effect, duration},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetRGB method is used to change the color RGB of a smart LED (red, green, blue from 0-255).
@@ -229,7 +247,7 @@ func (y *Yeelight) SetRGB(red, green, blue, duration int) (Response, error) {
 		Params: []interface{}{rgb, effect, duration},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetRGBhex method is used to change the color RGB of a smart LED (using hexadecimal).
@@ -255,7 +273,7 @@ func (y *Yeelight) SetRGBhex(value, duration int) (Response, error) {
 		Params: []interface{}{value, effect, duration},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetHSV method is used to change the color of a smart LED.
@@ -287,7 +305,7 @@ func (y *Yeelight) SetHSV(hue, sat, duration int) (Response, error) {
 		Params: []interface{}{hue, sat, effect, duration},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetBright method is used to change the brightness of a smart LED.
@@ -307,7 +325,7 @@ func (y *Yeelight) SetBright(brightness, duration int) (Response, error) {
 		Params: []interface{}{brightness, effect, duration},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetPower method is used to switch on or off the smart LED (software managed on/off).
@@ -327,7 +345,7 @@ func (y *Yeelight) SetPower(power string, duration int) (Response, error) {
 		Params: []interface{}{power, effect, duration},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //Toggle method is used to toggle the smart LED.
@@ -337,7 +355,7 @@ func (y *Yeelight) Toggle() (Response, error) {
 		Method: "toggle",
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetDefault method is used to save current state of smart LED in persistent
@@ -349,7 +367,7 @@ func (y *Yeelight) SetDefault() (Response, error) {
 		Method: "set_default",
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //StartCf method is used to start a color flow. Color flow is a series of smart
@@ -364,7 +382,7 @@ func (y *Yeelight) StartCf(count, action int, flowExpression string) (Response,
 		Params: []interface{}{count, action, flowExpression},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //StopCf method is used to stop a running color flow.
@@ -374,7 +392,7 @@ func (y *Yeelight) StopCf() (Response, error) {
 		Method: "stop_cf",
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetScene method is used to set the smart LED directly to specified state.
@@ -387,7 +405,7 @@ func (y *Yeelight) SetScene(class, values string) (Response, error) {
 		Params: []interface{}{class, values},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //CronAdd method is used to start a timer job on the smart LED.
@@ -398,7 +416,7 @@ func (y *Yeelight) CronAdd(t, value int) (Response, error) {
 		Params: []interface{}{t, value},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //CronGet method is used to retrieve the setting of the current cron job of the specified type.
@@ -420,7 +438,7 @@ func (y *Yeelight) CronDel(t int) (Response, error) {
 		Params: []interface{}{t},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetAdjust method is used to change brightness, CT or color of a smart LED
@@ -432,7 +450,7 @@ func (y *Yeelight) SetAdjust(action, prop string) (Response, error) {
 		Params: []interface{}{action, prop},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //SetName method is used to name the device. The name will be stored on the
@@ -445,7 +463,7 @@ func (y *Yeelight) SetName(name string) (Response, error) {
 		Params: []interface{}{name},
 	}
 
-	return y.request(cmd)
+	return y.requestOK(cmd)
 }
 
 //On method is used to switch on the smart LED